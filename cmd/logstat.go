@@ -1,27 +1,67 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/cjnosal/logstat/pkg/datetime"
 	"github.com/cjnosal/logstat/pkg/regex"
+	"github.com/cjnosal/logstat/pkg/unixtime"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
 
 	"github.com/cjnosal/logstat/lib"
 )
 
 var userDenoisePatterns []string
+var rulesFiles []string
 var searchPatterns []string
+var levels []string
 var datetimePatterns []string
 var datetimeFormats []string
+var discover int
+var inputsFile string
+var timezone string
+var displayTimezone string
+var skewAnchors []string
+var estimateSkew bool
+var maxSkew string
 var bucketLength string
 var noiseReplacement string
 var showBuckets bool
 var mergeFiles bool
+var follow bool
+var window string
+var stream bool
+var outputFormat string
+var wide bool
+var htmlReport string
+var svgChart string
+var svgClusters int
+var histogramWidth int
+var logScale bool
+var colorMode string
+var ascii bool
+var reorderWindow string
+var memoryBudget int
+var jobs int
+var clusterEngine string
+var drainDepth int
+var drainSimilarity float64
+var entryStart string
+var inputFormat string
+var timeField string
+var messageField string
+var groupFields []string
 
 var showGaps bool
 var minGap string
@@ -30,6 +70,8 @@ var minRepetition int
 var maxRepetition int
 var margin int
 var minCount int
+var topValues int
+var fuzzyMerge float64
 
 var startTime string
 var endTime string
@@ -41,9 +83,28 @@ var replaceNumbers bool
 var replaceLongWords bool
 var replaceLongHex bool
 var replaceEmails bool
+var replaceUrls bool
+var replaceMacs bool
+var replaceIPv4 bool
+var replaceIPv6 bool
+var replacePaths bool
+var replaceDurations bool
+var replaceK8s bool
 
 var logger *log.Logger
 
+const (
+	outputText   = "text"
+	outputJSON   = "json"
+	outputNDJSON = "ndjson"
+	outputCSV    = "csv"
+	outputTSV    = "tsv"
+
+	colorAuto   = "auto"
+	colorAlways = "always"
+	colorNever  = "never"
+)
+
 func main() {
 	logger = log.New(os.Stderr, "[main] ", 0)
 
@@ -54,16 +115,44 @@ func main() {
 		Run:   run,
 	}
 
-	command.Flags().StringArrayVarP(&searchPatterns, "search", "s", []string{}, "search for lines matching regex pattern")
+	command.Flags().StringVarP(&inputFormat, "input", "i", "text", "input format: text, json (one object per line), logfmt or syslog (rfc 3164 or 5424, with fields host, app, procid, msgid, facility and severity)")
+	command.Flags().StringVarP(&timeField, "timefield", "", "", "structured input field holding the line datetime (default time, timestamp, ts, @timestamp, date or datetime)")
+	command.Flags().StringVarP(&messageField, "messagefield", "", "", "structured input field holding the message to denoise (default msg, message, @message or log)")
+	command.Flags().StringArrayVarP(&groupFields, "groupby", "", []string{}, "structured input fields to group similar lines by")
+	command.Flags().StringArrayVarP(&searchPatterns, "search", "s", []string{}, "search for lines matching regex pattern\nwith structured input, field=pattern searches a single field")
+	command.Flags().StringSliceVarP(&levels, "level", "", []string{}, "only keep entries of these levels: fatal, error, warn, info, debug, trace or unknown\n(warn+ keeps warn and more severe levels)")
 
 	command.Flags().StringArrayVarP(&datetimePatterns, "datetime", "t", []string{}, "extract line datetime regex pattern")
-	command.Flags().StringArrayVarP(&datetimeFormats, "dateformat", "f", []string{}, "format for parsing extracted datetimes (use golang reference time 'Mon Jan 2 15:04:05 MST 2006')")
-	command.Flags().StringVarP(&startTime, "starttime", "", "", "exclude lines before this time")
-	command.Flags().StringVarP(&endTime, "endtime", "", "", "exclude lines after this time")
-
+	command.Flags().StringArrayVarP(&datetimeFormats, "dateformat", "f", []string{}, "format for parsing extracted datetimes (use golang reference time 'Mon Jan 2 15:04:05 MST 2006')\n'epoch' parses unix timestamps in seconds, millis, micros or nanos")
+	command.Flags().StringVarP(&inputsFile, "inputs", "", "", "yaml file mapping input globs to datetime profiles, patterns and formats\n(a single file can also be given as path:profile=name)")
+	command.Flags().IntVarP(&discover, "discover", "", 100, "sample this many lines of each file to choose a datetime format when -t and -f are not set (0 to disable)")
+	command.Flags().StringVarP(&entryStart, "entrystart", "e", "", "group continuation lines into multi-line entries (e.g. stack traces):\n'datetime' starts an entry at each line with a parseable datetime\n'indent' continues an entry with each indented line\nany other value is a regex matching the first line of an entry")
+	command.Flags().StringVarP(&timezone, "timezone", "", "", "IANA timezone (e.g. America/Toronto) for datetimes without an offset (default UTC)\n(a single file can also be given as path:timezone=name)")
+	command.Flags().StringVarP(&displayTimezone, "displaytimezone", "", "", "IANA timezone for bucket times (default the timezone of the first datetime)")
+	command.Flags().StringVarP(&startTime, "starttime", "", "", "exclude lines before this time, which can be a datetime (in a -f layout, or any built in layout without -f), relative to now (-2h, now-30m, yesterday 14:00, 14:00)\nor relative to the first or last datetime of the input (start+10m, end-15m)")
+	command.Flags().StringVarP(&endTime, "endtime", "", "", "exclude lines after this time (accepts the same relative times as --starttime)")
+
+	command.Flags().IntVarP(&jobs, "jobs", "j", 1, "number of goroutines parsing and denoising lines (see BenchmarkProcessStreamJobs in lib to measure the speedup)")
 	command.Flags().StringVarP(&bucketLength, "bucketlength", "l", "1m", "length of time in each bucket")
 	command.Flags().BoolVarP(&showBuckets, "showbuckets", "b", false, "show line counts for each time bucket")
+	command.Flags().IntVarP(&histogramWidth, "width", "", 0, "columns of each histogram row (default the terminal width, or bars of up to 40 characters when not writing to a terminal)")
+	command.Flags().BoolVarP(&logScale, "logscale", "", false, "scale histogram bars by the logarithm of their line counts")
+	command.Flags().StringVarP(&colorMode, "color", "", colorAuto, "color histogram bars by level: auto (when writing to a terminal and NO_COLOR is not set), always or never")
+	command.Flags().BoolVarP(&ascii, "ascii", "", false, "draw histogram bars with ascii glyphs by level (!#+*.) instead of unicode blocks")
+	command.Flags().StringVarP(&outputFormat, "output", "o", outputText, "output format: text, json (one document), ndjson (a record per bucket and gap),\ncsv or tsv (a row per bucket, cluster and source file)\njson and ndjson always include clusters, and original lines with -m (see README for the schema)")
+	command.Flags().BoolVarP(&wide, "wide", "", false, "with --output csv or tsv, write a row per bucket and a column per cluster")
+	command.Flags().StringVarP(&svgChart, "svg", "", "", "also write a bar chart of the lines in each bucket to this svg file")
+	command.Flags().IntVarP(&svgClusters, "svgclusters", "", 0, "stack the bars of the --svg chart by the most common clusters (e.g. 5 for the top 5)")
+	command.Flags().IntVarP(&topValues, "values", "", 0, "with -b or --output json/ndjson, show the most common values replaced by each placeholder of a cluster (e.g. 3 for the top 3),\nwith min, max and percentiles of numeric values and durations")
 	command.Flags().BoolVarP(&mergeFiles, "mergefiles", "m", false, "show original lines from each file interleaved by time")
+	command.Flags().StringArrayVarP(&skewAnchors, "skewanchor", "", []string{}, "regex pattern matching the same event in each merged file, used to estimate clock offsets between files")
+	command.Flags().BoolVarP(&estimateSkew, "estimateskew", "", false, "estimate clock offsets between merged files by cross-correlating their line counts")
+	command.Flags().StringVarP(&maxSkew, "maxskew", "", "5m", "largest clock offset to consider with --estimateskew")
+	command.Flags().BoolVarP(&follow, "follow", "", false, "keep reading files as they grow or rotate and refresh output every bucket length\n(with -e, an entry is complete once no continuation lines arrive for a bucket length)")
+	command.Flags().StringVarP(&window, "window", "", "", "when following, discard buckets older than this duration")
+	command.Flags().BoolVarP(&stream, "stream", "", false, "print each bucket as soon as it is complete instead of reading the whole input first\n(a histogram row per bucket, followed by its lines with -b)")
+	command.Flags().StringVarP(&reorderWindow, "reorderwindow", "", "1m", "when streaming, wait this long past the end of a bucket for out of order lines")
+	command.Flags().IntVarP(&memoryBudget, "memorybudget", "", 512, "when streaming, megabytes of original lines to hold in memory before spilling to disk")
 
 	command.Flags().BoolVarP(&showGaps, "showgaps", "g", false, "show bucket gaps and occurrences for denoised lines")
 	command.Flags().StringVarP(&minGap, "mingap", "", "", "exclude gaps smaller than this duration")
@@ -73,7 +162,12 @@ func main() {
 	command.Flags().IntVarP(&margin, "margin", "", 0, "max difference in number of similar lines in two buckets")
 	command.Flags().IntVarP(&minCount, "mincount", "", 1, "minimum number of similar lines in a bucket")
 
+	command.Flags().StringVarP(&clusterEngine, "cluster", "c", lib.ClusterRegex, "how similar lines are clustered after denoising:\n'regex' clusters identical denoised lines\n'drain' learns templates (e.g. 'User <*> logged in from <*>') from the denoised lines")
+	command.Flags().IntVarP(&drainDepth, "draindepth", "", 4, "depth of the drain parse tree (lines are routed by their first depth-2 words)")
+	command.Flags().Float64VarP(&drainSimilarity, "drainsimilarity", "", 0.4, "fraction of words a line must share with a drain template to join it")
+	command.Flags().Float64VarP(&fuzzyMerge, "fuzzymerge", "", 0, "merge clusters whose words are at least this similar (e.g. 0.8) by word edit distance,\nshowing differing words as the -n string")
 	command.Flags().StringArrayVarP(&userDenoisePatterns, "denoise", "d", []string{}, "regex patterns to ignore when determining unique lines (e.g. timestamps, guids)\ncan include custom replacement (overriding -n) with -d pattern=replacement\ncan escape = with \\")
+	command.Flags().StringArrayVarP(&rulesFiles, "rules", "", []string{}, fmt.Sprintf("yaml file of denoise rules, or a built-in rule profile (%s)\nrules named like a built-in or earlier rule change it in place (see README)", strings.Join(lib.DenoiseProfileNames(), ", ")))
 	command.Flags().StringVarP(&noiseReplacement, "noise", "n", "*", "default string to show where user provided denoise patterns were removed")
 	command.Flags().BoolVarP(&replaceGuids, "guids", "", true, "denoise guids")
 	command.Flags().BoolVarP(&replaceBase64, "base64", "", true, "denoise base64 strings")
@@ -82,6 +176,24 @@ func main() {
 	command.Flags().BoolVarP(&replaceLongWords, "longwords", "", true, "denoise 20+ character words")
 	command.Flags().BoolVarP(&replaceLongHex, "longhex", "", true, "denoise 16+ character hexadecimal strings")
 	command.Flags().BoolVarP(&replaceEmails, "emails", "", true, "denoise all emails")
+	command.Flags().BoolVarP(&replaceUrls, "urls", "", true, "denoise urls (including query strings)")
+	command.Flags().BoolVarP(&replaceMacs, "macs", "", true, "denoise MAC addresses")
+	command.Flags().BoolVarP(&replaceIPv4, "ipv4", "", true, "denoise IPv4 addresses (with optional port)")
+	command.Flags().BoolVarP(&replaceIPv6, "ipv6", "", true, "denoise IPv6 addresses")
+	command.Flags().BoolVarP(&replacePaths, "paths", "", true, "denoise windows paths, and unix paths under a well known root (/var, /etc, /home...) or ending in a file name with an extension")
+	command.Flags().BoolVarP(&replaceDurations, "durations", "", true, "denoise go (1m30s, 150ms) and ISO 8601 (PT1H30M) durations")
+	command.Flags().BoolVarP(&replaceK8s, "k8s", "", true, "denoise kubernetes pod and replicaset suffixes (web-7d9f8c-abcde becomes web-(pod), web-7d9f8c becomes web-(replicaset))")
+
+	report := cobra.Command{
+		Use:   "report [files...]",
+		Short: "write an interactive html report",
+		Long:  "write a self-contained html report with a volume chart, the clusters and their original lines,\nperiodic patterns (with -g) and the parameters of the run",
+		Args:  cobra.ArbitraryArgs,
+		Run:   run,
+	}
+	report.Flags().StringVarP(&htmlReport, "html", "", "", "path of the html report to write")
+	report.Flags().AddFlagSet(command.Flags())
+	command.AddCommand(&report)
 
 	err := command.Execute()
 	if err != nil {
@@ -96,130 +208,437 @@ func run(cmd *cobra.Command, args []string) {
 	var result *lib.Result
 	var err error
 
+	table := outputFormat == outputCSV || outputFormat == outputTSV
+	if outputFormat != outputText && outputFormat != outputJSON && outputFormat != outputNDJSON && !table {
+		logger.Printf("Error: unknown output format %s (expected text, json, ndjson, csv or tsv)\n", outputFormat)
+		os.Exit(1)
+	}
+	if table && showGaps {
+		logger.Printf("Error: --output %s does not support --showgaps\n", outputFormat)
+		os.Exit(1)
+	}
+	if colorMode != colorAuto && colorMode != colorAlways && colorMode != colorNever {
+		logger.Printf("Error: unknown color mode %s (expected auto, always or never)\n", colorMode)
+		os.Exit(1)
+	}
+	if wide && !table {
+		logger.Printf("Error: --wide requires --output csv or tsv\n")
+		os.Exit(1)
+	}
+	if svgChart != "" && (stream || follow) {
+		logger.Printf("Error: --svg does not support --stream or --follow\n")
+		os.Exit(1)
+	}
+	if cmd.Name() == "report" {
+		if htmlReport == "" {
+			logger.Printf("Error: report requires --html\n")
+			os.Exit(1)
+		}
+		if stream || follow || outputFormat != outputText {
+			logger.Printf("Error: report does not support --stream, --follow or --output\n")
+			os.Exit(1)
+		}
+	}
+
 	duration, err := time.ParseDuration(bucketLength)
 	if err != nil {
 		logger.Printf("Error parsing bucket length: %v\n", err)
 		os.Exit(1)
 	}
 
-	defaultDateTimePattern := regex.RFC3339LIKE
-	defaultDateTimeFormats := []string{
-		time.RFC3339Nano,                     // - T n Zhh:mm
-		"2006-01-02T15:04:05.999999999Z0700", // - T n Zhhmm
-		"2006-01-02T15:04:05.999999999Z07",   // - T n Zhh
-		time.RFC3339,                         // - T   Zhh:mm
-		"2006-01-02T15:04:05Z0700",           // - T   Zhhmm
-		"2006-01-02T15:04:05Z07",             // - T   Zhh
-		"2006-01-02T15:04:05.999999999",      // - T n
-		"2006-01-02T15:04:05",                // - T
-
-		"2006/01/02T15:04:05.999999999Z07:00", // / T n Zhh:mm
-		"2006/01/02T15:04:05.999999999Z0700",  // / T n Zhhmm
-		"2006/01/02T15:04:05.999999999Z07",    // / T n Zhh
-		"2006/01/02T15:04:05Z07:00",           // / T   Zhh:mm
-		"2006/01/02T15:04:05Z0700",            // / T   Zhhmm
-		"2006/01/02T15:04:05Z07",              // / T   Zhh
-		"2006/01/02T15:04:05.999999999",       // / T n
-		"2006/01/02T15:04:05",                 // / T
-
-		"2006-01-02 15:04:05.999999999Z07:00", // -   n Zhh:mm
-		"2006-01-02 15:04:05.999999999Z0700",  // -   n Zhhmm
-		"2006-01-02 15:04:05.999999999Z07",    // -   n Zhh
-		"2006-01-02 15:04:05Z07:00",           // -     Zhh:mm
-		"2006-01-02 15:04:05Z0700",            // -     Zhhmm
-		"2006-01-02 15:04:05Z07",              // -     Zhh
-		"2006-01-02 15:04:05.999999999",       // -   n
-		"2006-01-02 15:04:05",                 // -
-
-		"2006/01/02 15:04:05.999999999Z07:00", // /   n Zhh:mm
-		"2006/01/02 15:04:05.999999999Z0700",  // /   n Zhhmm
-		"2006/01/02 15:04:05.999999999Z07",    // /   n Zhh
-		"2006/01/02 15:04:05Z07:00",           // /     Zhh:mm
-		"2006/01/02 15:04:05Z0700",            // /     Zhhmm
-		"2006/01/02 15:04:05Z07",              // /     Zhh
-		"2006/01/02 15:04:05.999999999",       // /   n
-		"2006/01/02 15:04:05",                 // /
-	}
-	datetimeFormats = append(datetimeFormats, defaultDateTimeFormats...)
-	datetimePatterns = append(datetimePatterns, defaultDateTimePattern)
+	discoverLines := 0
+	if len(datetimePatterns) == 0 && len(datetimeFormats) == 0 {
+		discoverLines = discover
+	}
+	for _, f := range datetimeFormats {
+		if f == unixtime.Format {
+			datetimePatterns = append(datetimePatterns, regex.EPOCH)
+			break
+		}
+	}
+	datetimeFormats = append(datetimeFormats, datetime.ISO.Formats...)
+	datetimePatterns = append(datetimePatterns, datetime.ISO.Extractors...)
 
 	denoisePatterns := [][]string{}
 	// regexes must be ordered from more structured to less structured
 	for _, d := range datetimePatterns {
-		denoisePatterns = append(denoisePatterns, []string{d, "(date)"})
+		denoisePatterns = append(denoisePatterns, []string{d, lib.DateReplacement})
 	}
 
-	if replaceGuids {
-		denoisePatterns = append(denoisePatterns, []string{regex.GUID, "(guid)"})
-	}
-	if replaceBase64 {
-		denoisePatterns = append(denoisePatterns, []string{regex.BASE64, "(base64)"})
-	}
-	if replaceLongHex {
-		denoisePatterns = append(denoisePatterns, []string{regex.LONGHEX, "(hex)"})
-	}
-	if replaceLongWords {
-		denoisePatterns = append(denoisePatterns, []string{regex.LONGWORDS, "(longword)"})
+	ruleSets := [][]lib.DenoiseRule{}
+	for _, r := range rulesFiles {
+		if profile, ok := lib.DenoiseProfile(r); ok {
+			ruleSets = append(ruleSets, profile)
+			continue
+		}
+		f, err := os.Open(r)
+		if err != nil {
+			logger.Printf("Error opening rules file: %v\n", err)
+			os.Exit(1)
+		}
+		rules, err := lib.LoadRules(f)
+		f.Close()
+		if err != nil {
+			logger.Printf("Error parsing rules file %s: %v\n", r, err)
+			os.Exit(1)
+		}
+		ruleSets = append(ruleSets, rules)
 	}
-	if replaceEmails {
-		denoisePatterns = append(denoisePatterns, []string{regex.EMAILS, "(email)"})
+	// flags given on the command line override the rule files
+	toggles := []lib.DenoiseRule{}
+	for _, t := range []struct {
+		flag    string
+		enabled *bool
+		rules   []string
+	}{
+		{"guids", &replaceGuids, []string{"guids"}},
+		{"urls", &replaceUrls, []string{"urls"}},
+		{"macs", &replaceMacs, []string{"macs"}},
+		{"ipv6", &replaceIPv6, []string{"ipv6"}},
+		{"ipv4", &replaceIPv4, []string{"ipv4"}},
+		{"paths", &replacePaths, []string{"winpaths", "unixpaths"}},
+		{"k8s", &replaceK8s, []string{"k8s", "k8sreplicasets"}},
+		{"durations", &replaceDurations, []string{"durations"}},
+		{"base64", &replaceBase64, []string{"base64"}},
+		{"longhex", &replaceLongHex, []string{"longhex"}},
+		{"longwords", &replaceLongWords, []string{"longwords"}},
+		{"emails", &replaceEmails, []string{"emails"}},
+		{"alphanum", &replaceAlphaNumeric, []string{"alphanum"}},
+		{"numbers", &replaceNumbers, []string{"numbers"}},
+	} {
+		if !cmd.Flags().Changed(t.flag) {
+			continue
+		}
+		for _, name := range t.rules {
+			toggles = append(toggles, lib.DenoiseRule{
+				Name:    name,
+				Enabled: t.enabled,
+			})
+		}
 	}
+	ruleSets = append(ruleSets, toggles)
+	patterns := []lib.DenoiseRule{}
 	unescapedAssignment := regexp.MustCompile("[^\\\\]((\\\\\\\\)*)?=")
 	for _, d := range userDenoisePatterns {
 		indices := unescapedAssignment.FindStringIndex(d)
 		if indices == nil {
-			denoisePatterns = append(denoisePatterns, []string{d, noiseReplacement})
+			patterns = append(patterns, lib.DenoiseRule{Regex: d, Replacement: noiseReplacement})
 		} else {
-			denoisePatterns = append(denoisePatterns, []string{d[0:indices[1]-1], d[indices[1]:]})
+			patterns = append(patterns, lib.DenoiseRule{Regex: d[0 : indices[1]-1], Replacement: d[indices[1]:]})
 		}
 	}
-	if replaceAlphaNumeric {
-		denoisePatterns = append(denoisePatterns, []string{regex.ALPHANUM, "(alphanum)"})
+	denoiseRules, err := lib.DenoiseRules(ruleSets, patterns, noiseReplacement)
+	if err != nil {
+		logger.Printf("Error applying denoise rules: %v\n", err)
+		os.Exit(1)
+	}
+	denoiseRules = append(denoiseRules, lib.DenoiseRule{
+		Name:        "noise",
+		Regex:       fmt.Sprintf("(%s)+", regexp.QuoteMeta(noiseReplacement)),
+		Replacement: noiseReplacement,
+	})
+
+	location := time.UTC
+	if timezone != "" {
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			logger.Printf("Error parsing timezone: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	if replaceNumbers {
-		denoisePatterns = append(denoisePatterns, []string{regex.NUMBERS, "(number)"})
+	var displayLocation *time.Location
+	if displayTimezone != "" {
+		displayLocation, err = time.LoadLocation(displayTimezone)
+		if err != nil {
+			logger.Printf("Error parsing display timezone: %v\n", err)
+			os.Exit(1)
+		}
 	}
-	denoisePatterns = append(denoisePatterns, []string{fmt.Sprintf("(%s)+", regexp.QuoteMeta(noiseReplacement)), noiseReplacement})
 
 	var start *time.Time
 	var end *time.Time
+	var relativeStart *lib.RelativeTime
+	var relativeEnd *lib.RelativeTime
+	now := time.Now()
+	boundFormats := datetimeFormats
+	if discoverLines > 0 {
+		// the layout of the input isn't known yet, so accept any layout it could be discovered with
+		boundFormats = catalogFormats(datetimeFormats)
+	}
 	if startTime != "" {
-		start, err = parseTime(startTime, datetimeFormats)
+		start, relativeStart, err = parseBound(startTime, boundFormats, location, now)
 	}
 	if err != nil {
 		logger.Printf("Error parsing start time: %v\n", err)
 		os.Exit(1)
 	}
 	if endTime != "" {
-		end, err = parseTime(endTime, datetimeFormats)
+		end, relativeEnd, err = parseBound(endTime, boundFormats, location, now)
 	}
 	if err != nil {
 		logger.Printf("Error parsing end time: %v\n", err)
 		os.Exit(1)
 	}
 
+	maxSkewDuration, err := time.ParseDuration(maxSkew)
+	if err != nil {
+		logger.Printf("Error parsing maxskew: %v\n", err)
+		os.Exit(1)
+	}
+
+	var retention time.Duration
+	if window != "" {
+		retention, err = time.ParseDuration(window)
+		if err != nil {
+			logger.Printf("Error parsing window: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	var reorder time.Duration
+	if stream {
+		reorder, err = time.ParseDuration(reorderWindow)
+		if err != nil {
+			logger.Printf("Error parsing reorder window: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if jobs <= 0 {
+		jobs = 1
+	}
+
+	inputs := []lib.InputSpec{}
+	if inputsFile != "" {
+		f, err := os.Open(inputsFile)
+		if err != nil {
+			logger.Printf("Error opening inputs file: %v\n", err)
+			os.Exit(1)
+		}
+		inputs, err = lib.LoadInputSpecs(f)
+		f.Close()
+		if err != nil {
+			logger.Printf("Error parsing inputs file %s: %v\n", inputsFile, err)
+			os.Exit(1)
+		}
+	}
+	files := make([]string, len(args))
+	for i, arg := range args {
+		path, spec, err := parseInputArg(arg)
+		if err != nil {
+			logger.Printf("Error parsing input %s: %v\n", arg, err)
+			os.Exit(1)
+		}
+		files[i] = path
+		if spec != nil {
+			// specs on the command line take precedence over the inputs file
+			inputs = append([]lib.InputSpec{*spec}, inputs...)
+		}
+	}
+
 	config := lib.Config{
 		LineFilters:        searchPatterns,
 		DenoisePatterns:    denoisePatterns,
+		DenoiseRules:       denoiseRules,
+		Levels:             levels,
 		DateTimeExtractors: datetimePatterns,
 		DateTimeFormats:    datetimeFormats,
 		BucketDuration:     duration,
 		NoiseReplacement:   noiseReplacement,
-		KeepOriginalLines:  mergeFiles,
+		KeepOriginalLines:  mergeFiles || htmlReport != "",
 		StartTime:          start,
 		EndTime:            end,
+		RelativeStartTime:  relativeStart,
+		RelativeEndTime:    relativeEnd,
+		RetentionWindow:    retention,
+		EntryStart:         entryStart,
+		InputFormat:        inputFormat,
+		TimeField:          timeField,
+		MessageField:       messageField,
+		GroupFields:        groupFields,
+		DiscoverDateTime:   discoverLines,
+		Inputs:             inputs,
+		Location:           location,
+		DisplayLocation:    displayLocation,
+		ClockSkewAnchors:   skewAnchors,
+		EstimateClockSkew:  estimateSkew,
+		MaxClockSkew:       maxSkewDuration,
+		Jobs:               jobs,
+		ClusterEngine:      clusterEngine,
+		DrainDepth:         drainDepth,
+		DrainSimilarity:    drainSimilarity,
+		CaptureValues:      (showBuckets || outputFormat != outputText || htmlReport != "") && topValues > 0,
+		FuzzyMerge:         fuzzyMerge,
+	}
+
+	if stream {
+		if follow {
+			logger.Printf("Error: --stream and --follow cannot be combined\n")
+			os.Exit(1)
+		}
+		if relativeStart != nil || relativeEnd != nil {
+			logger.Printf("Error: --stream does not support start or end relative times\n")
+			os.Exit(1)
+		}
+		if fuzzyMerge > 0 {
+			logger.Printf("Error: --stream does not support --fuzzymerge\n")
+			os.Exit(1)
+		}
+		if outputFormat == outputJSON {
+			logger.Printf("Error: --stream does not support --output json (try ndjson)\n")
+			os.Exit(1)
+		}
+		config.StreamBucket = lsl.StreamPrinter(os.Stdout, showBuckets, mergeFiles, minCount, topValues, histogramOptions())
+		if outputFormat == outputNDJSON {
+			config.StreamBucket = lsl.NDJSONStreamPrinter(os.Stdout, reportOptions())
+		}
+		if table {
+			if wide {
+				logger.Printf("Error: --stream does not support --wide\n")
+				os.Exit(1)
+			}
+			config.StreamBucket = lsl.TableStreamPrinter(os.Stdout, tableOptions())
+		}
+		config.ReorderWindow = reorder
+		config.MemoryBudget = int64(memoryBudget) << 20
+		config.KeepStreamedCounts = showGaps
+	}
+
+	if follow {
+		if len(files) == 0 {
+			logger.Printf("Error: --follow requires at least one log file\n")
+			os.Exit(1)
+		}
+		if relativeStart != nil || relativeEnd != nil {
+			logger.Printf("Error: --follow does not support start or end relative times (try --window)\n")
+			os.Exit(1)
+		}
+		if outputFormat != outputText {
+			logger.Printf("Error: --follow only supports text output\n")
+			os.Exit(1)
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		err = lsl.Follow(ctx, files, config, func(result *lib.Result) error {
+			clearScreen()
+			render(lsl, result)
+			return nil
+		})
+		if err != nil {
+			logger.Printf("Error following logs: %v\n", err)
+			os.Exit(1)
+		}
+		return
 	}
-	if len(args) == 0 {
+
+	if len(files) == 0 {
 		result, err = lsl.ProcessStream(os.Stdin, config)
 	} else {
-		result, err = lsl.ProcessFiles(args, config)
+		result, err = lsl.ProcessFiles(files, config)
 	}
 	if err != nil {
 		logger.Printf("Error processing logs: %v\n", err)
 		os.Exit(1)
 	}
 
-	err = lsl.Histogram(result, os.Stdout)
+	if stream {
+		renderGaps(lsl, result)
+		return
+	}
+	if svgChart != "" {
+		writeChart(lsl, result, files, duration)
+	}
+	if htmlReport != "" {
+		writeHTMLReport(lsl, result, cmd, files)
+		return
+	}
+	render(lsl, result)
+}
+
+func writeChart(lsl lib.LogStat, result *lib.Result, files []string, duration time.Duration) {
+	options := lib.ChartOptions{
+		Title:          "logstat",
+		TopClusters:    svgClusters,
+		BucketDuration: duration,
+	}
+	if len(files) > 0 {
+		options.Title = "logstat: " + strings.Join(files, ", ")
+	}
+	f, err := os.Create(svgChart)
+	if err != nil {
+		logger.Printf("Error creating svg chart: %v\n", err)
+		os.Exit(1)
+	}
+	err = lsl.Chart(result, f, options)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		logger.Printf("Error writing svg chart: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func writeHTMLReport(lsl lib.LogStat, result *lib.Result, cmd *cobra.Command, files []string) {
+	options := lib.HTMLOptions{
+		Title:     "logstat report",
+		MinCount:  minCount,
+		TopValues: topValues,
+	}
+	inputs := "stdin"
+	if len(files) > 0 {
+		inputs = strings.Join(files, ", ")
+		options.Title = "logstat report: " + inputs
+	}
+	options.Parameters = []lib.ReportParameter{
+		{Name: "command", Value: strings.Join(os.Args, " ")},
+		{Name: "inputs", Value: inputs},
+		{Name: "generated", Value: time.Now().Format(time.RFC3339)},
+	}
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "bucketlength" || f.Changed && f.Name != "html" {
+			options.Parameters = append(options.Parameters, lib.ReportParameter{Name: f.Name, Value: f.Value.String()})
+		}
+	})
+	if showGaps {
+		gaps := gapOptions()
+		options.Gaps = &gaps
+	}
+
+	f, err := os.Create(htmlReport)
+	if err != nil {
+		logger.Printf("Error creating html report: %v\n", err)
+		os.Exit(1)
+	}
+	err = lsl.HTMLReport(result, f, options)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err != nil {
+		logger.Printf("Error writing html report: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func render(lsl lib.LogStat, result *lib.Result) {
+	if outputFormat == outputCSV || outputFormat == outputTSV {
+		err := lsl.Table(result, os.Stdout, tableOptions())
+		if err != nil {
+			logger.Printf("Error writing %s output: %v\n", outputFormat, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if outputFormat != outputText {
+		writeReport(lsl.Report(result, reportOptions()))
+		return
+	}
+
+	err := lsl.Histogram(result, os.Stdout, histogramOptions())
 	if err != nil {
 		logger.Printf("Error rendering histogram: %v\n", err)
 		os.Exit(1)
@@ -227,50 +646,152 @@ func run(cmd *cobra.Command, args []string) {
 
 	if showBuckets {
 		os.Stdout.Write([]byte{'\n'})
-		err = lsl.Buckets(result, os.Stdout, mergeFiles, minCount)
+		err = lsl.Buckets(result, os.Stdout, mergeFiles, minCount, topValues)
 		if err != nil {
 			logger.Printf("Error rendering buckets: %v\n", err)
 			os.Exit(1)
 		}
 	}
 
-	if showGaps {
-		var min *time.Duration
-		var max *time.Duration
-		if minGap != "" {
-			gap, err := time.ParseDuration(minGap)
-			if err != nil {
-				logger.Printf("Error parsing minGap: %v\n", err)
-				os.Exit(1)
-			} else {
-				min = &gap
-			}
-		}
-		if maxGap != "" {
-			gap, err := time.ParseDuration(maxGap)
-			if err != nil {
-				logger.Printf("Error parsing maxGap: %v\n", err)
-				os.Exit(1)
-			} else {
-				max = &gap
-			}
-		}
+	renderGaps(lsl, result)
+}
 
-		os.Stdout.Write([]byte{'\n'})
-		err = lsl.LastSeen(result, os.Stdout, min, max, minRepetition, maxRepetition, minCount, margin)
+func renderGaps(lsl lib.LogStat, result *lib.Result) {
+	if !showGaps {
+		return
+	}
+	options := gapOptions()
+	if outputFormat != outputText {
+		// streamed buckets have already been written
+		writeReport(&lib.Report{
+			Version: lib.ReportVersion,
+			Gaps:    lsl.Report(result, reportOptions()).Gaps,
+		})
+		return
+	}
+	os.Stdout.Write([]byte{'\n'})
+	err := lsl.LastSeen(result, os.Stdout, options.MinGap, options.MaxGap, options.MinRepetition,
+		options.MaxRepetition, options.MinCount, options.Margin)
+	if err != nil {
+		logger.Printf("Error rendering gaps: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func gapOptions() lib.GapOptions {
+	options := lib.GapOptions{
+		MinRepetition: minRepetition,
+		MaxRepetition: maxRepetition,
+		MinCount:      minCount,
+		Margin:        margin,
+	}
+	if minGap != "" {
+		gap, err := time.ParseDuration(minGap)
+		if err != nil {
+			logger.Printf("Error parsing minGap: %v\n", err)
+			os.Exit(1)
+		}
+		options.MinGap = &gap
+	}
+	if maxGap != "" {
+		gap, err := time.ParseDuration(maxGap)
 		if err != nil {
-			logger.Printf("Error rendering gaps: %v\n", err)
+			logger.Printf("Error parsing maxGap: %v\n", err)
 			os.Exit(1)
 		}
+		options.MaxGap = &gap
+	}
+	return options
+}
+
+// histogramOptions fit unicode bars colored by level to the terminal when writing to one, and draw
+// ascii bars of up to 40 characters otherwise
+func histogramOptions() lib.HistogramOptions {
+	fd := int(os.Stdout.Fd())
+	terminal := term.IsTerminal(fd)
+	options := lib.HistogramOptions{
+		Width:       histogramWidth,
+		LogScale:    logScale,
+		Unicode:     terminal && !ascii,
+		Color:       colorMode == colorAlways || colorMode == colorAuto && terminal && os.Getenv("NO_COLOR") == "",
+		ShortLabels: terminal,
+	}
+	if options.Width <= 0 && terminal {
+		width, _, err := term.GetSize(fd)
+		if err == nil {
+			options.Width = width
+		}
+	}
+	return options
+}
+
+func reportOptions() lib.ReportOptions {
+	options := lib.ReportOptions{
+		ShowOriginalLines: mergeFiles,
+		MinCount:          minCount,
+		TopValues:         topValues,
+	}
+	if showGaps {
+		gaps := gapOptions()
+		options.Gaps = &gaps
+	}
+	return options
+}
+
+func tableOptions() lib.TableOptions {
+	options := lib.TableOptions{
+		MinCount: minCount,
+		Wide:     wide,
+	}
+	if outputFormat == outputTSV {
+		options.Comma = '\t'
+	}
+	return options
+}
+
+func writeReport(report *lib.Report) {
+	var err error
+	if outputFormat == outputJSON {
+		err = lib.WriteJSON(report, os.Stdout)
+	} else {
+		err = lib.WriteNDJSON(report, os.Stdout)
+	}
+	if err != nil {
+		logger.Printf("Error writing %s output: %v\n", outputFormat, err)
+		os.Exit(1)
+	}
+}
+
+func clearScreen() {
+	info, err := os.Stdout.Stat()
+	if err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		os.Stdout.Write([]byte("\033[H\033[2J"))
+	} else {
+		os.Stdout.Write([]byte{'\n'})
 	}
 }
 
-func parseTime(datetime string, formats []string) (*time.Time, error) {
-	for _, format := range formats {
-		lt, e := time.Parse(format, datetime)
-		if e == nil {
-			return &lt, nil
+var inputArgOptions = regexp.MustCompile("^(.+):(\\w+=[^,]*(,\\w+=[^,]*)*)$")
+
+// parseInputArg splits path:key=value,key=value into the path and an input spec
+func parseInputArg(arg string) (string, *lib.InputSpec, error) {
+	m := inputArgOptions.FindStringSubmatch(arg)
+	if m == nil {
+		return arg, nil, nil
+	}
+	spec := &lib.InputSpec{
+		Glob: m[1],
+	}
+	for _, option := range strings.Split(m[2], ",") {
+		kv := strings.SplitN(option, "=", 2)
+		switch kv[0] {
+		case "profile":
+			spec.Profile = kv[1]
+		case "timezone":
+			spec.Timezone = kv[1]
+		default:
+			return "", nil, fmt.Errorf("unknown input option %s (expected profile or timezone)", kv[0])
 		}
 	}
-	return nil, fmt.Errorf("%s does not match any formats in %v", datetime, formats)
+	return m[1], spec, nil
 }
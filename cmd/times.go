@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjnosal/logstat/lib"
+	"github.com/cjnosal/logstat/pkg/datetime"
+)
+
+var (
+	inputRelative = regexp.MustCompile("^(start|end)\\s*(([+-])\\s*(\\S+))?$")
+	nowRelative   = regexp.MustCompile("^(now)?\\s*(([+-])\\s*(\\S+))?$")
+	dayRelative   = regexp.MustCompile("^(today|yesterday)?\\s*(\\d?\\d:\\d\\d(:\\d\\d(\\.\\d+)?)?)?$")
+	days          = regexp.MustCompile("(\\d+(\\.\\d+)?)d")
+)
+
+// parseBound parses an absolute datetime, a time relative to now (-2h, now-30m, yesterday 14:00, 14:00)
+// or a time relative to the first or last datetime of the input (start+10m, end-5m)
+func parseBound(value string, formats []string, location *time.Location, now time.Time) (*time.Time, *lib.RelativeTime, error) {
+	value = strings.TrimSpace(value)
+	if m := inputRelative.FindStringSubmatch(value); m != nil {
+		offset, err := parseOffset(m[3], m[4])
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &lib.RelativeTime{
+			Anchor: m[1],
+			Offset: offset,
+		}, nil
+	}
+	if m := nowRelative.FindStringSubmatch(value); m != nil && value != "" {
+		offset, err := parseOffset(m[3], m[4])
+		if err != nil {
+			return nil, nil, err
+		}
+		t := now.Add(offset)
+		return &t, nil, nil
+	}
+	if m := dayRelative.FindStringSubmatch(value); m != nil && value != "" {
+		now = now.In(location)
+		day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, location)
+		if m[1] == "yesterday" {
+			day = day.AddDate(0, 0, -1)
+		}
+		if m[2] != "" {
+			clock, err := time.Parse("15:04:05.999999999", m[2]+strings.Repeat(":00", 2-strings.Count(m[2], ":")))
+			if err != nil {
+				return nil, nil, err
+			}
+			day = time.Date(day.Year(), day.Month(), day.Day(), clock.Hour(), clock.Minute(), clock.Second(), clock.Nanosecond(), location)
+		}
+		return &day, nil, nil
+	}
+	t := parseTime(value, formats, location, now)
+	if t == nil {
+		return nil, nil, fmt.Errorf("%s is not a time relative to now (-2h, now-30m, yesterday 14:00, 14:00), relative to the input (start+10m, end-15m)\nor a datetime in one of the layouts: %s", value, strings.Join(datetimeForms(formats), ", "))
+	}
+	return t, nil, nil
+}
+
+// parseOffset parses a signed duration, also accepting days (e.g. 1d12h)
+func parseOffset(sign string, duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
+	}
+	var err error
+	duration = days.ReplaceAllStringFunc(duration, func(d string) string {
+		n, e := strconv.ParseFloat(strings.TrimSuffix(d, "d"), 64)
+		if e != nil {
+			err = e
+		}
+		return fmt.Sprintf("%gh", n*24)
+	})
+	if err != nil {
+		return 0, err
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, err
+	}
+	if sign == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// parseTime parses an absolute datetime, inferring the year of layouts without one (e.g. syslog)
+// relative to now, or returns nil if no format matches
+func parseTime(value string, formats []string, location *time.Location, now time.Time) *time.Time {
+	for _, format := range formats {
+		lt, e := datetime.ParseInLocation(format, value, location)
+		if e == nil {
+			if lt.Year() == 0 {
+				lt = datetime.NewYearInferrer(now.In(location)).Infer(lt)
+			}
+			return &lt
+		}
+	}
+	return nil
+}
+
+// catalogFormats adds the layouts of every catalog profile to formats
+func catalogFormats(formats []string) []string {
+	all := append([]string{}, formats...)
+	seen := map[string]bool{}
+	for _, f := range all {
+		seen[f] = true
+	}
+	for _, p := range datetime.Catalog {
+		for _, f := range p.Formats {
+			if !seen[f] {
+				all = append(all, f)
+				seen[f] = true
+			}
+		}
+	}
+	return all
+}
+
+// datetimeForms describes formats by the catalog profiles they include, followed by any other layouts
+func datetimeForms(formats []string) []string {
+	included := map[string]bool{}
+	for _, f := range formats {
+		included[f] = true
+	}
+	forms := []string{}
+	described := map[string]bool{}
+	for _, p := range append([]datetime.Profile{datetime.ISO}, datetime.Catalog...) {
+		all := true
+		undescribed := false
+		for _, f := range p.Formats {
+			all = all && included[f]
+			undescribed = undescribed || !described[f]
+		}
+		if all && undescribed {
+			forms = append(forms, fmt.Sprintf("%s (%s)", p.Name, p.Description))
+			for _, f := range p.Formats {
+				described[f] = true
+			}
+		}
+	}
+	for _, f := range formats {
+		if !described[f] {
+			forms = append(forms, f)
+			described[f] = true
+		}
+	}
+	return forms
+}
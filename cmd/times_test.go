@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjnosal/logstat/lib"
+	"github.com/cjnosal/logstat/pkg/datetime"
+)
+
+func TestParseBound(t *testing.T) {
+	now := time.Date(2023, time.October, 17, 12, 0, 0, 0, time.UTC)
+	formats := catalogFormats(datetime.ISO.Formats)
+	tests := []struct {
+		value    string
+		expected time.Time
+		relative *lib.RelativeTime
+		err      string
+	}{
+		{value: "2023-10-17T04:00:00Z", expected: time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+		{value: "Oct 17 04:00:00", expected: time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+		{value: "Dec 31 23:00:00", expected: time.Date(2022, time.December, 31, 23, 0, 0, 0, time.UTC)},
+		{value: "17/Oct/2023:04:00:00 -0400", expected: time.Date(2023, time.October, 17, 8, 0, 0, 0, time.UTC)},
+		{value: "2023-10-17 04:00:00,123", expected: time.Date(2023, time.October, 17, 4, 0, 0, 123000000, time.UTC)},
+		{value: "1697515200", expected: time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+		{value: "-2h", expected: time.Date(2023, time.October, 17, 10, 0, 0, 0, time.UTC)},
+		{value: "yesterday 14:00", expected: time.Date(2023, time.October, 16, 14, 0, 0, 0, time.UTC)},
+		{value: "end-5m", relative: &lib.RelativeTime{Anchor: lib.RelativeToEnd, Offset: -5 * time.Minute}},
+		{value: "bogus", err: "syslog (bsd syslog Oct 17 04:12:01)"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			absolute, relative, err := parseBound(test.value, formats, time.UTC, now)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected an error listing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.relative != nil {
+				if relative == nil || *relative != *test.relative {
+					t.Fatalf("expected %+v, got %+v", test.relative, relative)
+				}
+				return
+			}
+			if absolute == nil || !absolute.Equal(test.expected) {
+				t.Fatalf("expected %s, got %v", test.expected, absolute)
+			}
+		})
+	}
+}
+
+func TestDatetimeForms(t *testing.T) {
+	forms := datetimeForms(append([]string{"2006.01.02 15:04"}, datetime.ISO.Formats...))
+	expected := []string{"iso (rfc3339-like numeric datetimes)", "2006.01.02 15:04"}
+	if strings.Join(forms, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, forms)
+	}
+}
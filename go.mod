@@ -1,5 +1,17 @@
 module github.com/cjnosal/logstat
 
-go 1.13
+go 1.22
 
-require github.com/spf13/cobra v1.0.0
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/spf13/cobra v1.0.0
+	github.com/spf13/pflag v1.0.3
+	github.com/ulikunitz/xz v0.5.12
+	golang.org/x/term v0.10.0
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	golang.org/x/sys v0.10.0 // indirect
+)
@@ -0,0 +1,110 @@
+package lib
+
+import (
+	"time"
+)
+
+const (
+	RelativeToStart = "start"
+	RelativeToEnd   = "end"
+)
+
+// RelativeTime is a time relative to the first or last datetime of the input
+type RelativeTime struct {
+	Anchor string
+	Offset time.Duration
+}
+
+func (r *RelativeTime) resolve(first time.Time, last time.Time) time.Time {
+	if r.Anchor == RelativeToEnd {
+		return last.Add(r.Offset)
+	}
+	return first.Add(r.Offset)
+}
+
+// applyRelativeBounds removes lines outside of RelativeStartTime and RelativeEndTime once the
+// first and last datetimes of the input are known
+func applyRelativeBounds(result *Result, config Config) {
+	if config.RelativeStartTime == nil && config.RelativeEndTime == nil {
+		return
+	}
+	var first, last *time.Time
+	for _, bucket := range result.Buckets {
+		for _, cluster := range bucket.Clusters {
+			for t := range cluster.OriginalLines {
+				if t.Year() <= epoch.Year() {
+					// lines without datetimes
+					continue
+				}
+				if first == nil || t.Before(*first) {
+					lt := t
+					first = &lt
+				}
+				if last == nil || t.After(*last) {
+					lt := t
+					last = &lt
+				}
+			}
+		}
+	}
+	if first == nil {
+		return
+	}
+	var start, end *time.Time
+	if config.RelativeStartTime != nil {
+		t := config.RelativeStartTime.resolve(*first, *last)
+		start = &t
+	}
+	if config.RelativeEndTime != nil {
+		t := config.RelativeEndTime.resolve(*first, *last)
+		end = &t
+	}
+
+	notes := map[string]string{}
+	for bucketStart, bucket := range result.Buckets {
+		for ref, cluster := range bucket.Clusters {
+			removed := false
+			for t, lines := range cluster.OriginalLines {
+				if (start != nil && t.Before(*start)) || (end != nil && t.After(*end)) {
+					bucket.LineCount -= len(lines)
+					cluster.Count -= len(lines)
+					for _, tag := range cluster.lineTags[t] {
+						bucket.Levels = addCount(bucket.Levels, tag.level, -1)
+						cluster.Levels = addCount(cluster.Levels, tag.level, -1)
+						cluster.Sources = addCount(cluster.Sources, tag.source, -1)
+					}
+					delete(cluster.lineTags, t)
+					delete(cluster.OriginalLines, t)
+					delete(cluster.lineValues, t)
+					removed = true
+				}
+			}
+			if removed && cluster.lineValues != nil {
+				cluster.recountValues()
+			}
+			if len(cluster.OriginalLines) == 0 {
+				delete(bucket.Clusters, ref)
+			}
+		}
+		if len(bucket.Clusters) == 0 {
+			for note, value := range bucket.Notes {
+				notes[note] = value
+			}
+			delete(result.Buckets, bucketStart)
+		}
+	}
+
+	// keep the notes of removed buckets on the first remaining bucket
+	var firstBucket *time.Time
+	for bucketStart := range result.Buckets {
+		if firstBucket == nil || bucketStart.Before(*firstBucket) {
+			t := bucketStart
+			firstBucket = &t
+		}
+	}
+	if firstBucket != nil {
+		for note, value := range notes {
+			result.Buckets[*firstBucket].Notes[note] = value
+		}
+	}
+}
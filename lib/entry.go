@@ -0,0 +1,302 @@
+package lib
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/datetime"
+	"github.com/cjnosal/logstat/pkg/jsonl"
+	"github.com/cjnosal/logstat/pkg/level"
+	"github.com/cjnosal/logstat/pkg/line"
+	"github.com/cjnosal/logstat/pkg/logfmt"
+	"github.com/cjnosal/logstat/pkg/syslog"
+	"github.com/cjnosal/logstat/pkg/unixtime"
+)
+
+const (
+	DateReplacement = "(date)"
+
+	InputText   = "text"
+	InputJSON   = "json"
+	InputLogfmt = "logfmt"
+	InputSyslog = "syslog"
+)
+
+var (
+	defaultTimeFields    = []string{"time", "timestamp", "ts", "@timestamp", "date", "datetime"}
+	defaultMessageFields = []string{"msg", "message", "@message", "log"}
+	defaultLevelFields   = []string{"level", "lvl", "severity", "loglevel", "log.level", "levelname", "@level"}
+
+	fieldFilterPattern = regexp.MustCompile("^([\\w.@-]+)=(.*)$")
+)
+
+type entry struct {
+	raw       string
+	message   string
+	signature string
+	fields    map[string]string
+	time      *time.Time
+	denoised  string
+	level     string
+	group     string
+	labels    []string
+	values    []string
+}
+
+type fieldFilter struct {
+	field   string
+	pattern *regexp.Regexp
+}
+
+func structured(config Config) bool {
+	return config.InputFormat != "" && config.InputFormat != InputText
+}
+
+// splitFilters separates key=regex field filters from whole line filters for structured input
+func splitFilters(config Config) ([]string, []*fieldFilter, error) {
+	if !structured(config) {
+		return config.LineFilters, nil, nil
+	}
+	lineFilters := []string{}
+	fieldFilters := []*fieldFilter{}
+	for _, f := range config.LineFilters {
+		m := fieldFilterPattern.FindStringSubmatch(f)
+		if m == nil {
+			lineFilters = append(lineFilters, f)
+			continue
+		}
+		r, err := regexp.Compile(m[2])
+		if err != nil {
+			return nil, nil, err
+		}
+		fieldFilters = append(fieldFilters, &fieldFilter{
+			field:   m[1],
+			pattern: r,
+		})
+	}
+	return lineFilters, fieldFilters, nil
+}
+
+// newLineProcessor filters and denoises the lines of a source
+func newLineProcessor(config Config, source string) (line.LineProcessor, error) {
+	lineFilters, _, err := splitFilters(config)
+	if err != nil {
+		return nil, err
+	}
+	return line.NewLineProcessor(lineFilters, denoisePatterns(config, source, ""), config.DateTimeExtractors)
+}
+
+// newProfileLineProcessor extracts and denoises datetimes with the extractors of a discovered profile
+func newProfileLineProcessor(config Config, profile *datetime.Profile, source string) (line.LineProcessor, error) {
+	lineFilters, _, err := splitFilters(config)
+	if err != nil {
+		return nil, err
+	}
+	patterns := [][]string{}
+	for _, e := range profile.Extractors {
+		patterns = append(patterns, []string{e, DateReplacement})
+	}
+	patterns = append(patterns, denoisePatterns(config, source, "")...)
+	return line.NewLineProcessor(lineFilters, patterns, profile.Extractors)
+}
+
+func (src *source) matches(e *entry) bool {
+	if len(src.lineFilters) == 0 && len(src.fieldFilters) == 0 {
+		return true
+	}
+	if len(src.lineFilters) > 0 && src.lp.Match(e.raw) {
+		return true
+	}
+	for _, f := range src.fieldFilters {
+		value, ok := e.fields[f.field]
+		if ok && f.pattern.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// newEntryParser returns a parser for the configured input format. Parsers keep no state between
+// lines, so years missing from syslog timestamps are left for processLine to infer in line order.
+func newEntryParser(config Config) (func(raw string) (*entry, error), error) {
+	switch config.InputFormat {
+	case "", InputText:
+		return func(raw string) (*entry, error) {
+			return &entry{
+				raw:     raw,
+				message: raw,
+			}, nil
+		}, nil
+	case InputJSON:
+		return func(raw string) (*entry, error) {
+			fields, err := jsonl.Parse(raw)
+			if err != nil {
+				return nil, err
+			}
+			return structuredEntry(raw, fields, config), nil
+		}, nil
+	case InputLogfmt:
+		return func(raw string) (*entry, error) {
+			pairs, err := logfmt.Parse(raw)
+			if err != nil {
+				return nil, err
+			}
+			fields := map[string]string{}
+			keys := []string{}
+			for _, p := range pairs {
+				if _, ok := fields[p.Key]; !ok {
+					keys = append(keys, p.Key)
+				}
+				fields[p.Key] = p.Value
+			}
+			sort.Strings(keys)
+			e := structuredEntry(raw, fields, config)
+			e.signature = fmt.Sprintf(" {%s}", strings.Join(keys, " "))
+			return e, nil
+		}, nil
+	case InputSyslog:
+		parser := syslog.NewYearlessParser(config.Location)
+		return func(raw string) (*entry, error) {
+			m, err := parser.Parse(raw)
+			if err != nil {
+				return nil, err
+			}
+			fields := map[string]string{
+				"host":   m.Hostname,
+				"app":    m.AppName,
+				"procid": m.ProcID,
+				"msgid":  m.MsgID,
+				"sd":     m.StructuredData,
+			}
+			if m.Priority >= 0 {
+				fields["priority"] = strconv.Itoa(m.Priority)
+				fields["facility"] = strconv.Itoa(m.Facility)
+				fields["severity"] = strconv.Itoa(m.Severity)
+			}
+			e := &entry{
+				raw:     raw,
+				message: m.Message,
+				fields:  fields,
+			}
+			if !m.Timestamp.IsZero() {
+				e.time = &m.Timestamp
+			}
+			return e, nil
+		}, nil
+	}
+	return nil, fmt.Errorf("Unknown input format %s", config.InputFormat)
+}
+
+func structuredEntry(raw string, fields map[string]string, config Config) *entry {
+	e := &entry{
+		raw:     raw,
+		message: raw,
+		fields:  fields,
+	}
+	if field, ok := findField(fields, config.MessageField, defaultMessageFields); ok {
+		e.message = fields[field]
+	}
+	if field, ok := findField(fields, config.TimeField, defaultTimeFields); ok {
+		e.time = parseFieldTime(fields[field], config)
+	}
+	return e
+}
+
+func findField(fields map[string]string, field string, defaults []string) (string, bool) {
+	if field != "" {
+		_, ok := fields[field]
+		return field, ok
+	}
+	for _, d := range defaults {
+		if _, ok := fields[d]; ok {
+			return d, true
+		}
+	}
+	return "", false
+}
+
+func parseFieldTime(value string, config Config) *time.Time {
+	if t, err := unixtime.Parse(value); err == nil {
+		return &t
+	}
+	for _, format := range append([]string{time.RFC3339Nano}, config.DateTimeFormats...) {
+		t, err := datetime.ParseInLocation(format, value, config.Location)
+		if err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// groupPrefix labels a cluster with the values of the grouping fields, denoised by the rules for each field
+func (src *source) groupPrefix(e *entry, config Config) string {
+	if len(config.GroupFields) == 0 || e.fields == nil {
+		return ""
+	}
+	group := []string{}
+	for _, g := range config.GroupFields {
+		if value, ok := e.fields[g]; ok {
+			if d, ok := src.denoisers[g]; ok {
+				value = d.Denoise(value)
+			}
+			group = append(group, fmt.Sprintf("%s=%s", g, value))
+		}
+	}
+	if len(group) == 0 {
+		return ""
+	}
+	return "[" + strings.Join(group, " ") + "] "
+}
+
+// detectLevel finds the level of an entry in its level fields, then in its text
+func detectLevel(e *entry) string {
+	for _, f := range defaultLevelFields {
+		if value, ok := e.fields[f]; ok {
+			if l := level.Normalize(value); l != level.Unknown {
+				return l
+			}
+		}
+	}
+	return level.Detect(e.raw)
+}
+
+// lineTag is the level and source of a line, kept to update the counts when lines are removed
+type lineTag struct {
+	level  string
+	source string
+}
+
+// addCount adds count lines to the lines counted by key (a level or source), creating the counts if needed
+func addCount(counts map[string]int, key string, count int) map[string]int {
+	if counts == nil {
+		counts = map[string]int{}
+	}
+	counts[key] += count
+	if counts[key] == 0 {
+		delete(counts, key)
+	}
+	return counts
+}
+
+func addCounts(counts map[string]int, other map[string]int) map[string]int {
+	for key, count := range other {
+		counts = addCount(counts, key, count)
+	}
+	return counts
+}
+
+// mergeCounts adds the level and source counts, and the tags of each line, of another cluster
+func (c *Cluster) mergeCounts(other *Cluster) {
+	c.Levels = addCounts(c.Levels, other.Levels)
+	c.Sources = addCounts(c.Sources, other.Sources)
+	for t, tags := range other.lineTags {
+		if c.lineTags == nil {
+			c.lineTags = map[time.Time][]lineTag{}
+		}
+		c.lineTags[t] = append(c.lineTags[t], tags...)
+	}
+}
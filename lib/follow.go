@@ -0,0 +1,249 @@
+package lib
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	followPollInterval = 250 * time.Millisecond
+	// bytes at the start of a followed file compared to detect copytruncate rotation
+	fingerprintSize = 1024
+)
+
+type follower struct {
+	path        string
+	file        *os.File
+	info        os.FileInfo
+	offset      int64
+	fingerprint []byte
+	partial     string
+	missing     bool
+	lastRead    time.Time
+	src         *source
+}
+
+func (l *logStat) Follow(ctx context.Context, logFiles []string, config Config, refresh func(*Result) error) error {
+	if len(logFiles) == 0 {
+		return fmt.Errorf("At least one log file required")
+	}
+	result := &Result{
+		Buckets: map[time.Time]*Bucket{},
+	}
+	followers := make([]*follower, len(logFiles))
+	for i, lf := range logFiles {
+		src, err := newSource(lf, fmt.Sprintf("start of %s", lf), config, time.Now())
+		if err != nil {
+			return err
+		}
+		followers[i] = &follower{
+			path:     lf,
+			lastRead: time.Now(),
+			src:      src,
+		}
+	}
+	defer func() {
+		for _, f := range followers {
+			f.close()
+		}
+	}()
+
+	poll := func() error {
+		for _, f := range followers {
+			err := l.poll(f, config, result)
+			if err != nil {
+				return err
+			}
+		}
+		trimBuckets(result, config.RetentionWindow)
+		return nil
+	}
+
+	err := poll()
+	if err != nil {
+		return err
+	}
+	err = refresh(resultView(result, config))
+	if err != nil {
+		return err
+	}
+
+	pollTicker := time.NewTicker(followPollInterval)
+	defer pollTicker.Stop()
+	refreshTicker := time.NewTicker(config.BucketDuration)
+	defer refreshTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-pollTicker.C:
+			err = poll()
+		case <-refreshTicker.C:
+			err = refresh(resultView(result, config))
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// poll reads any complete lines appended to the followed file, reopening it after
+// rename+create rotation and rewinding it after copytruncate rotation
+func (l *logStat) poll(f *follower, config Config, result *Result) error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if !f.missing {
+				l.logger.Printf("Waiting for %s to appear\n", f.path)
+				f.missing = true
+			}
+			return l.readAppended(f, config, result)
+		}
+		return err
+	}
+	f.missing = false
+
+	if f.file != nil && !os.SameFile(f.info, info) {
+		err = l.readAppended(f, config, result)
+		if err != nil {
+			return err
+		}
+		l.flushPartial(f, config, result)
+		l.finishSource(f.src, config, result)
+		f.close()
+	}
+	if f.file == nil {
+		file, err := os.Open(f.path)
+		if err != nil {
+			return err
+		}
+		f.file = file
+		f.offset = 0
+		f.fingerprint = nil
+	} else {
+		truncated, err := f.truncated(info)
+		if err != nil {
+			return err
+		}
+		if truncated {
+			_, err = f.file.Seek(0, io.SeekStart)
+			if err != nil {
+				return err
+			}
+			f.offset = 0
+			f.fingerprint = nil
+			f.partial = ""
+		}
+	}
+	f.info = info
+	offset := f.offset
+	err = l.readAppended(f, config, result)
+	now := time.Now()
+	if f.offset != offset {
+		f.lastRead = now
+	} else if err == nil {
+		// idle, so the sample is complete, and the last multi-line entry once no continuation lines
+		// arrived for a bucket length
+		if f.src.sampling {
+			l.discover(f.src, config, result)
+		}
+		if now.Sub(f.lastRead) >= config.BucketDuration {
+			l.flushEntry(f.src, config, result)
+		}
+	}
+	l.flushBatch(f.src, config, result)
+	return err
+}
+
+// truncated reports whether the followed file was truncated since the last poll, including when
+// it grew back past the offset already read, by comparing its first bytes to those read before
+func (f *follower) truncated(info os.FileInfo) (bool, error) {
+	if info.Size() < f.offset {
+		return true, nil
+	}
+	if len(f.fingerprint) == 0 || info.ModTime().Equal(f.info.ModTime()) {
+		return false, nil
+	}
+	head := make([]byte, len(f.fingerprint))
+	_, err := f.file.ReadAt(head, 0)
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return !bytes.Equal(head, f.fingerprint), nil
+}
+
+func (l *logStat) readAppended(f *follower, config Config, result *Result) error {
+	if f.file == nil {
+		return nil
+	}
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := f.file.Read(buf)
+		if n > 0 {
+			if len(f.fingerprint) < fingerprintSize && f.offset == int64(len(f.fingerprint)) {
+				end := fingerprintSize - len(f.fingerprint)
+				if end > n {
+					end = n
+				}
+				f.fingerprint = append(f.fingerprint, buf[:end]...)
+			}
+			f.offset += int64(n)
+			data := f.partial + string(buf[:n])
+			lines := strings.Split(data, "\n")
+			f.partial = lines[len(lines)-1]
+			for _, str := range lines[:len(lines)-1] {
+				l.processSourceLine(f.src, str, config, result)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (l *logStat) flushPartial(f *follower, config Config, result *Result) {
+	if f.partial != "" {
+		l.processSourceLine(f.src, f.partial, config, result)
+		f.partial = ""
+	}
+}
+
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+func trimBuckets(result *Result, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	var latest *time.Time
+	for k := range result.Buckets {
+		if latest == nil || k.After(*latest) {
+			t := k
+			latest = &t
+		}
+	}
+	if latest == nil {
+		return
+	}
+	cutoff := latest.Add(-window)
+	for k := range result.Buckets {
+		if !k.After(cutoff) {
+			delete(result.Buckets, k)
+		}
+	}
+}
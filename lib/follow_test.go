@@ -0,0 +1,123 @@
+package lib
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestFollower(t *testing.T, config Config) (*logStat, *follower, *Result) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	err := ioutil.WriteFile(path, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := newSource(path, "start of "+path, config, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+	f := &follower{path: path, lastRead: time.Now(), src: src}
+	t.Cleanup(f.close)
+	return l, f, &Result{Buckets: map[time.Time]*Bucket{}}
+}
+
+func appendLines(t *testing.T, path string, lines ...string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	_, err = file.WriteString(strings.Join(lines, "\n") + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func followedLines(result *Result) []string {
+	lines := []string{}
+	for _, bucket := range result.Buckets {
+		for _, c := range bucket.Clusters {
+			for _, original := range c.OriginalLines {
+				lines = append(lines, original...)
+			}
+		}
+	}
+	return lines
+}
+
+func TestFollowCopytruncate(t *testing.T) {
+	config := testConfig()
+	l, f, result := newTestFollower(t, config)
+	appendLines(t, f.path,
+		"2023-10-17T04:00:01Z old 1",
+		"2023-10-17T04:00:02Z old 2")
+	err := l.poll(f, config, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// truncated and grown past the offset already read between two polls
+	err = ioutil.WriteFile(f.path, []byte("2023-10-17T04:01:01Z new line 1\n2023-10-17T04:01:02Z new line 2\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	err = os.Chtimes(f.path, later, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = l.poll(f, config, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := followedLines(result)
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines, got %q", lines)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, " old ") && !strings.Contains(line, " new line ") {
+			t.Errorf("expected whole lines, got %q", line)
+		}
+	}
+}
+
+func TestFollowWaitsForContinuationLines(t *testing.T) {
+	config := testConfig()
+	config.EntryStart = EntryStartDateTime
+	l, f, result := newTestFollower(t, config)
+	appendLines(t, f.path,
+		"2023-10-17T04:00:01Z ERROR failed",
+		"java.lang.IllegalStateException: bad state",
+		"\tat com.example.Foo.bar(Foo.java:12)")
+	for i := 0; i < 2; i++ {
+		err := l.poll(f, config, result)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if lines := followedLines(result); len(lines) != 0 {
+		t.Fatalf("expected the entry to wait for continuation lines, got %q", lines)
+	}
+
+	appendLines(t, f.path, "\tat com.example.Main.main(Main.java:7)")
+	err := l.poll(f, config, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// idle for a bucket length
+	f.lastRead = time.Now().Add(-config.BucketDuration)
+	err = l.poll(f, config, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := followedLines(result)
+	if len(lines) != 1 || !strings.HasSuffix(lines[0], "Main.java:7)") {
+		t.Fatalf("expected the whole stack trace, got %q", lines)
+	}
+}
@@ -0,0 +1,253 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/level"
+)
+
+const (
+	// longest bar when HistogramOptions.Width is not set
+	defaultBarWidth = 40
+	// shortest bar when fitting rows to HistogramOptions.Width
+	minBarWidth = 10
+	// columns reserved for the counts of streamed rows, which aren't known in advance
+	streamCountsWidth = 24
+
+	shortLabelLayout = "2006-01-02 15:04:05 MST"
+	fullBlock        = "█"
+)
+
+// levelGlyphs draw the levels of ascii histogram bars
+var levelGlyphs = map[string]string{
+	level.Fatal:   "!",
+	level.Error:   "#",
+	level.Warn:    "+",
+	level.Info:    "*",
+	level.Debug:   ".",
+	level.Trace:   ".",
+	level.Unknown: "*",
+}
+
+// levelColors are the ANSI colors of histogram bars by level
+var levelColors = map[string]string{
+	level.Fatal: "35",
+	level.Error: "31",
+	level.Warn:  "33",
+	level.Info:  "32",
+	level.Debug: "90",
+	level.Trace: "90",
+}
+
+// partialBlocks draw the last 1 to 7 eighths of a unicode bar
+var partialBlocks = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// HistogramOptions control how histogram rows are drawn. The zero value draws ascii bars of up to 40
+// characters labeled with full bucket times.
+type HistogramOptions struct {
+	// columns of each row including its label and counts, e.g. the terminal width (0 for bars of up
+	// to 40 characters)
+	Width int
+	// scale bars by the logarithm of their line counts
+	LogScale bool
+	// draw bars with unicode blocks to an eighth of a character
+	Unicode bool
+	// color the levels of bars with ANSI escapes
+	Color bool
+	// leave the date out of bucket times on the same day as the previous row
+	ShortLabels bool
+}
+
+// barWidth is the longest bar that fits in a row with reserved columns of label and counts
+func (o HistogramOptions) barWidth(reserved int) int {
+	if o.Width <= 0 {
+		return defaultBarWidth
+	}
+	if o.Width-reserved < minBarWidth {
+		return minBarWidth
+	}
+	return o.Width - reserved
+}
+
+// histogramLabeler labels histogram rows with their bucket times
+type histogramLabeler struct {
+	short    bool
+	lastDate string
+}
+
+func (h *histogramLabeler) label(t time.Time) string {
+	if !h.short {
+		return fmt.Sprintf("%s: ", t)
+	}
+	label := t.Format(shortLabelLayout)
+	date := t.Format("2006-01-02")
+	if date == h.lastDate {
+		label = strings.Repeat(" ", len(date)+1) + label[len(date)+1:]
+	}
+	h.lastDate = date
+	return label + ": "
+}
+
+func (l *logStat) Histogram(result *Result, out io.Writer, options HistogramOptions) error {
+	bucketTimes := make(timeSlice, 0, len(result.Buckets))
+	maxCount := 0
+	for k, bucket := range result.Buckets {
+		bucketTimes = append(bucketTimes, k)
+		if bucket.LineCount > maxCount {
+			maxCount = bucket.LineCount
+		}
+	}
+	sort.Sort(bucketTimes)
+
+	labeler := &histogramLabeler{short: options.ShortLabels}
+	labels := make([]string, len(bucketTimes))
+	reserved := 0
+	for i, startTime := range bucketTimes {
+		labels[i] = labeler.label(startTime)
+		width := len([]rune(labels[i])) + len(histogramCounts(result.Buckets[startTime]))
+		if width > reserved {
+			reserved = width
+		}
+	}
+	barWidth := options.barWidth(reserved)
+
+	for i, startTime := range bucketTimes {
+		bucket := result.Buckets[startTime]
+		writeHistogramRow(out, labels[i], bucket, barEighths(bucket.LineCount, maxCount, barWidth, options.LogScale), options)
+	}
+	return nil
+}
+
+func writeHistogramRow(out io.Writer, label string, bucket *Bucket, eighths int, options HistogramOptions) {
+	notes := []string{}
+	for note := range bucket.Notes {
+		notes = append(notes, note)
+	}
+	sort.Strings(notes)
+	for _, note := range notes {
+		out.Write([]byte(fmt.Sprintf("  %s\n", note)))
+	}
+	out.Write([]byte(label))
+	out.Write([]byte(levelBar(bucket, eighths, options)))
+	out.Write([]byte(histogramCounts(bucket) + "\n"))
+}
+
+// histogramCounts follows a bar with the line count of its bucket and any detected levels
+func histogramCounts(bucket *Bucket) string {
+	return fmt.Sprintf(" %d%s", bucket.LineCount, levelCounts(bucket))
+}
+
+// barEighths scales a line count to eighths of a character: a character per line when every bucket
+// fits in width, and at least an eighth for any bucket with lines
+func barEighths(count int, maxCount int, width int, logScale bool) int {
+	if count <= 0 {
+		return 0
+	}
+	var eighths int
+	switch {
+	case logScale:
+		eighths = int(math.Round(math.Log1p(float64(count)) / math.Log1p(float64(maxCount)) * float64(width*8)))
+	case maxCount <= width:
+		eighths = count * 8
+	default:
+		eighths = int(math.Round(float64(count) * float64(width*8) / float64(maxCount)))
+	}
+	if eighths < 1 {
+		return 1
+	}
+	return eighths
+}
+
+// levelBar stacks the levels of a bucket from most to least severe. Ascii bars draw each level with
+// its own glyph and round to whole characters (at least one); unicode bars end with a partial block
+// in the color of their last level.
+func levelBar(bucket *Bucket, eighths int, options HistogramOptions) string {
+	cells := eighths / 8
+	partial := eighths % 8
+	if !options.Unicode {
+		cells = (eighths + 4) / 8
+		if cells == 0 && eighths > 0 {
+			cells = 1
+		}
+		partial = 0
+	}
+
+	segments := levelSegments(bucket, cells)
+	if partial > 0 {
+		if len(segments) == 0 {
+			segments = append(segments, levelSegment{level: mostCommonLevel(bucket)})
+		}
+		segments[len(segments)-1].partial = partial
+	}
+	s := ""
+	for _, segment := range segments {
+		glyph := levelGlyphs[segment.level]
+		if options.Unicode {
+			glyph = fullBlock
+		}
+		s += colorize(strings.Repeat(glyph, segment.cells)+partialBlocks[segment.partial], segment.level, options.Color)
+	}
+	return s
+}
+
+type levelSegment struct {
+	level   string
+	cells   int
+	partial int
+}
+
+// levelSegments splits cells between the levels of a bucket, most severe first
+func levelSegments(bucket *Bucket, cells int) []levelSegment {
+	if len(bucket.Levels) == 0 || bucket.LineCount <= 0 {
+		return []levelSegment{{level: level.Unknown, cells: cells}}
+	}
+	segments := []levelSegment{}
+	seen := 0
+	drawn := 0
+	for _, l := range level.Levels {
+		seen += bucket.Levels[l]
+		end := int(math.Round(float64(seen) * float64(cells) / float64(bucket.LineCount)))
+		if end > drawn {
+			segments = append(segments, levelSegment{level: l, cells: end - drawn})
+		}
+		drawn = end
+	}
+	return segments
+}
+
+func mostCommonLevel(bucket *Bucket) string {
+	common := level.Unknown
+	for _, l := range level.Levels {
+		if bucket.Levels[l] > bucket.Levels[common] {
+			common = l
+		}
+	}
+	return common
+}
+
+func colorize(s string, l string, color bool) string {
+	code := levelColors[l]
+	if !color || code == "" || s == "" {
+		return s
+	}
+	return "\033[" + code + "m" + s + "\033[0m"
+}
+
+// levelCounts lists the detected levels of a bucket, e.g. " (error 3, info 12)"
+func levelCounts(bucket *Bucket) string {
+	counts := []string{}
+	for _, l := range level.Levels {
+		if l != level.Unknown && bucket.Levels[l] > 0 {
+			counts = append(counts, fmt.Sprintf("%s %d", l, bucket.Levels[l]))
+		}
+	}
+	if len(counts) == 0 {
+		return ""
+	}
+	return " (" + strings.Join(counts, ", ") + ")"
+}
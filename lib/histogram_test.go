@@ -0,0 +1,129 @@
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestBarEighths(t *testing.T) {
+	tests := []struct {
+		name     string
+		count    int
+		maxCount int
+		width    int
+		logScale bool
+		eighths  int
+	}{
+		{"empty", 0, 10, 40, false, 0},
+		{"a character per line", 3, 10, 40, false, 24},
+		{"scaled", 50, 200, 40, false, 80},
+		{"rounded to the nearest eighth", 1, 30, 10, false, 3},
+		{"never empty", 1, 100000, 40, false, 1},
+		{"log scale max", 1000, 1000, 40, true, 320},
+		{"log scale", 1, 1000000, 40, true, 16},
+		{"log scale never empty", 1, 1 << 62, 1, true, 1},
+	}
+	for _, test := range tests {
+		eighths := barEighths(test.count, test.maxCount, test.width, test.logScale)
+		if eighths != test.eighths {
+			t.Errorf("%s: expected %d eighths, got %d", test.name, test.eighths, eighths)
+		}
+	}
+}
+
+func TestLevelSegments(t *testing.T) {
+	tests := []struct {
+		name     string
+		bucket   *Bucket
+		cells    int
+		segments []levelSegment
+	}{
+		{
+			name:     "no levels",
+			bucket:   &Bucket{LineCount: 3},
+			cells:    5,
+			segments: []levelSegment{{level: "unknown", cells: 5}},
+		},
+		{
+			name:     "most severe first",
+			bucket:   &Bucket{LineCount: 4, Levels: map[string]int{"info": 3, "error": 1}},
+			cells:    8,
+			segments: []levelSegment{{level: "error", cells: 2}, {level: "info", cells: 6}},
+		},
+		{
+			name:     "rare levels may round away",
+			bucket:   &Bucket{LineCount: 100, Levels: map[string]int{"info": 99, "warn": 1}},
+			cells:    10,
+			segments: []levelSegment{{level: "info", cells: 10}},
+		},
+	}
+	for _, test := range tests {
+		segments := levelSegments(test.bucket, test.cells)
+		if !reflect.DeepEqual(segments, test.segments) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.segments, segments)
+		}
+	}
+}
+
+func TestLevelBar(t *testing.T) {
+	bucket := &Bucket{LineCount: 2, Levels: map[string]int{"error": 1, "info": 1}}
+	tests := []struct {
+		name    string
+		eighths int
+		options HistogramOptions
+		bar     string
+	}{
+		{"ascii", 32, HistogramOptions{}, "##**"},
+		{"ascii rounds to characters", 12, HistogramOptions{}, "#*"},
+		{"ascii never empty", 1, HistogramOptions{}, "#"},
+		{"unicode eighths", 11, HistogramOptions{Unicode: true}, "█▍"},
+		{"unicode never empty", 1, HistogramOptions{Unicode: true}, "▏"},
+		{"ansi levels", 32, HistogramOptions{Color: true}, "\033[31m##\033[0m\033[32m**\033[0m"},
+		{"ansi partial block", 20, HistogramOptions{Unicode: true, Color: true}, "\033[31m█\033[0m\033[32m█▌\033[0m"},
+	}
+	for _, test := range tests {
+		bar := levelBar(bucket, test.eighths, test.options)
+		if bar != test.bar {
+			t.Errorf("%s: expected %q, got %q", test.name, test.bar, bar)
+		}
+	}
+}
+
+func TestHistogramFitsWidth(t *testing.T) {
+	lines := []string{}
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		for j := 0; j <= i*100; j++ {
+			lines = append(lines, start.Add(time.Duration(i)*time.Minute).Format(time.RFC3339)+" request handled")
+		}
+	}
+	result := process(t, strings.Join(lines, "\n")+"\n", testConfig())
+	lsl := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+
+	for _, width := range []int{60, 100} {
+		out := &bytes.Buffer{}
+		err := lsl.Histogram(result, out, HistogramOptions{Width: width, Unicode: true, ShortLabels: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		longest := 0
+		for _, row := range strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n") {
+			n := utf8.RuneCountInString(row)
+			if n > width {
+				t.Errorf("expected rows of at most %d columns, got %d: %q", width, n, row)
+			}
+			if n > longest {
+				longest = n
+			}
+		}
+		if longest != width {
+			t.Errorf("expected the longest row to fill %d columns, got %d", width, longest)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package lib
+
+import (
+	"encoding/json"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// lines of each cluster included in html reports by default
+const defaultReportLines = 100
+
+// ReportParameter is a setting of the run shown in html reports
+type ReportParameter struct {
+	Name  string
+	Value string
+}
+
+// HTMLOptions select what an html report includes. Gaps are only included when Gaps is set.
+type HTMLOptions struct {
+	Title      string
+	Parameters []ReportParameter
+	MinCount   int
+	TopValues  int
+	// original lines of each cluster to include (default 100)
+	MaxLines int
+	Gaps     *GapOptions
+}
+
+type htmlData struct {
+	Buckets  []htmlBucket  `json:"buckets"`
+	Clusters []htmlCluster `json:"clusters"`
+	Gaps     []GapReport   `json:"gaps"`
+}
+
+type htmlBucket struct {
+	Start  time.Time      `json:"start"`
+	Count  int            `json:"count"`
+	Levels map[string]int `json:"levels,omitempty"`
+	Notes  []string       `json:"notes,omitempty"`
+}
+
+// htmlCluster totals a cluster across buckets, with its count in each bucket by bucket index
+type htmlCluster struct {
+	Reference string       `json:"reference"`
+	Count     int          `json:"count"`
+	Buckets   map[int]int  `json:"buckets"`
+	Values    []string     `json:"values,omitempty"`
+	Lines     []LineReport `json:"lines,omitempty"`
+	MoreLines int          `json:"moreLines,omitempty"`
+}
+
+// HTMLReport writes a self-contained html page with an interactive volume chart, the clusters with at
+// least MinCount lines in a bucket and their original lines, and any gaps
+func (l *logStat) HTMLReport(result *Result, out io.Writer, options HTMLOptions) error {
+	maxLines := options.MaxLines
+	if maxLines <= 0 {
+		maxLines = defaultReportLines
+	}
+	data := htmlData{
+		Buckets:  []htmlBucket{},
+		Clusters: []htmlCluster{},
+		Gaps:     []GapReport{},
+	}
+
+	bucketTimes := make(timeSlice, 0, len(result.Buckets))
+	for k := range result.Buckets {
+		bucketTimes = append(bucketTimes, k)
+	}
+	sort.Sort(bucketTimes)
+
+	clusters := map[string]*htmlCluster{}
+	merged := map[string]*Cluster{}
+	for i, startTime := range bucketTimes {
+		bucket := result.Buckets[startTime]
+		hb := htmlBucket{
+			Start:  startTime,
+			Count:  bucket.LineCount,
+			Levels: bucket.Levels,
+		}
+		for note := range bucket.Notes {
+			hb.Notes = append(hb.Notes, note)
+		}
+		sort.Strings(hb.Notes)
+		data.Buckets = append(data.Buckets, hb)
+
+		for ref, c := range bucket.Clusters {
+			if c.Count < options.MinCount {
+				continue
+			}
+			hc := clusters[ref]
+			if hc == nil {
+				hc = &htmlCluster{
+					Reference: ref,
+					Buckets:   map[int]int{},
+				}
+				clusters[ref] = hc
+				merged[ref] = &Cluster{}
+			}
+			merged[ref].mergeValues(c)
+			merged[ref].Count += c.Count
+			hc.Count += c.Count
+			hc.Buckets[i] = c.Count
+			lineTimes := make(timeSlice, 0, len(c.OriginalLines))
+			for t := range c.OriginalLines {
+				lineTimes = append(lineTimes, t)
+			}
+			sort.Sort(lineTimes)
+			for _, t := range lineTimes {
+				for _, line := range c.OriginalLines[t] {
+					if len(hc.Lines) >= maxLines {
+						hc.MoreLines++
+						continue
+					}
+					hc.Lines = append(hc.Lines, LineReport{
+						Time: t,
+						Line: line,
+					})
+				}
+			}
+		}
+	}
+	for ref, hc := range clusters {
+		if options.TopValues > 0 {
+			for _, v := range merged[ref].Values {
+				if v != nil {
+					hc.Values = append(hc.Values, summarizeValues(v, options.TopValues).String())
+				}
+			}
+		}
+		data.Clusters = append(data.Clusters, *hc)
+	}
+	sort.Slice(data.Clusters, func(i, j int) bool {
+		if data.Clusters[i].Count != data.Clusters[j].Count {
+			return data.Clusters[i].Count > data.Clusters[j].Count
+		}
+		return data.Clusters[i].Reference < data.Clusters[j].Reference
+	})
+
+	if options.Gaps != nil {
+		for _, g := range l.Gaps(result, *options.Gaps) {
+			data.Gaps = append(data.Gaps, gapReport(g))
+		}
+	}
+
+	// json.Marshal escapes <, > and & so the data cannot close the script element
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return reportTemplate.Execute(out, map[string]interface{}{
+		"Title":      options.Title,
+		"Parameters": options.Parameters,
+		"Data":       template.JS(encoded),
+	})
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+h1 { font-size: 1.4em; }
+h2 { font-size: 1.15em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { text-align: left; padding: 4px 8px; border-bottom: 1px solid #e4e4e4; vertical-align: top; }
+th { background: #f6f6f6; }
+td.count { text-align: right; width: 6em; font-variant-numeric: tabular-nums; }
+code, pre { font-family: Menlo, Consolas, monospace; font-size: 0.85em; white-space: pre-wrap; word-break: break-all; }
+pre { margin: 0; background: #fafafa; padding: 8px; }
+tr.cluster { cursor: pointer; }
+tr.cluster:hover { background: #f0f6ff; }
+tr.detail td { background: #fafafa; }
+.values { color: #555; margin-bottom: 6px; }
+#chart { width: 100%; height: 260px; display: block; }
+#chart .bar:hover { opacity: 0.7; }
+#chart .selected { stroke: #000; stroke-width: 1; }
+#chart text { font-size: 11px; fill: #555; }
+.legend span { display: inline-block; margin-right: 1em; font-size: 0.85em; }
+.legend i { display: inline-block; width: 10px; height: 10px; margin-right: 4px; }
+.toolbar { margin: 0.5em 0; }
+#selection { margin-left: 1em; color: #555; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+
+<h2>Parameters</h2>
+<table>
+{{range .Parameters}}<tr><th>{{.Name}}</th><td><code>{{.Value}}</code></td></tr>
+{{end}}</table>
+
+<h2>Volume</h2>
+<div class="legend" id="legend"></div>
+<svg id="chart"></svg>
+
+<h2>Clusters</h2>
+<div class="toolbar">
+<input id="filter" type="search" placeholder="filter clusters" size="40">
+<button id="all" type="button">all buckets</button>
+<span id="selection"></span>
+</div>
+<table>
+<thead><tr><th class="count">lines</th><th>cluster (click to show lines)</th></tr></thead>
+<tbody id="clusters"></tbody>
+</table>
+
+<h2>Periodic patterns</h2>
+<table>
+<thead><tr><th>interval</th><th class="count">occurrences</th><th class="count">magnitude</th><th>cluster</th></tr></thead>
+<tbody id="gaps"></tbody>
+</table>
+
+<script id="data" type="application/json">{{.Data}}</script>
+<script>
+(function () {
+  var data = JSON.parse(document.getElementById("data").textContent);
+  var levels = ["fatal", "error", "warn", "info", "debug", "trace", "unknown"];
+  var colors = {fatal: "#6a1b9a", error: "#d32f2f", warn: "#f9a825", info: "#1976d2", debug: "#90a4ae", trace: "#cfd8dc", unknown: "#64b5f6"};
+  var svgNS = "http://www.w3.org/2000/svg";
+  var selected = null;
+
+  function el(tag, attrs, text) {
+    var e = document.createElement(tag);
+    for (var k in attrs) { e.setAttribute(k, attrs[k]); }
+    if (text !== undefined) { e.textContent = text; }
+    return e;
+  }
+  function svgEl(tag, attrs) {
+    var e = document.createElementNS(svgNS, tag);
+    for (var k in attrs) { e.setAttribute(k, attrs[k]); }
+    return e;
+  }
+  function label(t) {
+    return t.replace("T", " ").replace(/(\.\d+)?(Z|[+-]\d\d:\d\d)$/, "");
+  }
+  function stack(b) {
+    var parts = [], seen = 0;
+    levels.forEach(function (l) {
+      var n = (b.levels && b.levels[l]) || 0;
+      if (l === "unknown") { n = b.count - seen; }
+      if (n > 0) { parts.push([l, n]); }
+      seen += n;
+    });
+    return parts;
+  }
+
+  var used = {};
+  data.buckets.forEach(function (b) { stack(b).forEach(function (p) { used[p[0]] = true; }); });
+  var legend = document.getElementById("legend");
+  levels.forEach(function (l) {
+    if (!used[l]) { return; }
+    var s = el("span", {}, l);
+    s.insertBefore(el("i", {style: "background:" + colors[l]}), s.firstChild);
+    legend.appendChild(s);
+  });
+
+  // buckets without lines are left out of the data, so place each bucket by its time to show them as gaps
+  var slots = data.buckets.map(function (b, i) { return i; });
+  if (data.buckets.length > 1) {
+    var times = data.buckets.map(function (b) { return Date.parse(b.start); });
+    var length = Infinity;
+    for (var i = 1; i < times.length; i++) { length = Math.min(length, times[i] - times[i - 1]); }
+    if (length > 0 && (times[times.length - 1] - times[0]) / length < 5000) {
+      slots = times.map(function (t) { return Math.round((t - times[0]) / length); });
+    }
+  }
+
+  function drawChart() {
+    var svg = document.getElementById("chart");
+    while (svg.firstChild) { svg.removeChild(svg.firstChild); }
+    var width = svg.clientWidth || 900, height = svg.clientHeight || 260;
+    var left = 50, right = 10, top = 10, bottom = 40;
+    if (data.buckets.length === 0) { return; }
+    var n = slots[slots.length - 1] + 1;
+    var max = 1;
+    data.buckets.forEach(function (b) { max = Math.max(max, b.count); });
+    var plotWidth = width - left - right, plotHeight = height - top - bottom;
+    var step = plotWidth / n;
+    var barWidth = Math.max(1, step - (step > 4 ? 1 : 0));
+
+    [0, 0.5, 1].forEach(function (f) {
+      var y = top + plotHeight * (1 - f);
+      svg.appendChild(svgEl("line", {x1: left, x2: width - right, y1: y, y2: y, stroke: "#eee"}));
+      var t = svgEl("text", {x: left - 6, y: y + 4, "text-anchor": "end"});
+      t.textContent = Math.round(max * f);
+      svg.appendChild(t);
+    });
+
+    var ticks = Math.min(data.buckets.length, Math.max(1, Math.floor(plotWidth / 140)));
+    var lastTick = -Infinity;
+    for (var k = 0; k < ticks; k++) {
+      var i = Math.floor(k * data.buckets.length / ticks);
+      if ((slots[i] - lastTick) * step < 140) { continue; }
+      lastTick = slots[i];
+      var t = svgEl("text", {x: left + slots[i] * step, y: height - bottom + 16});
+      t.textContent = label(data.buckets[i].start);
+      svg.appendChild(t);
+    }
+
+    data.buckets.forEach(function (b, i) {
+      var x = left + slots[i] * step;
+      var y = top + plotHeight;
+      var g = svgEl("g", {"class": "bar" + (selected === i ? " selected" : "")});
+      stack(b).forEach(function (p) {
+        var h = plotHeight * p[1] / max;
+        y -= h;
+        g.appendChild(svgEl("rect", {x: x, y: y, width: barWidth, height: h, fill: colors[p[0]]}));
+      });
+      // an invisible full height target makes small buckets easy to click
+      g.appendChild(svgEl("rect", {x: x, y: top, width: Math.max(barWidth, 1), height: plotHeight, fill: "transparent"}));
+      var title = svgEl("title", {});
+      title.textContent = label(b.start) + ": " + b.count + " lines" +
+        stack(b).map(function (p) { return "\n" + p[0] + " " + p[1]; }).join("") +
+        (b.notes || []).map(function (note) { return "\n" + note; }).join("");
+      g.appendChild(title);
+      g.addEventListener("click", function () { select(selected === i ? null : i); });
+      svg.appendChild(g);
+      if (b.notes && b.notes.length) {
+        svg.appendChild(svgEl("line", {x1: x, x2: x, y1: top, y2: top + plotHeight, stroke: "#888", "stroke-dasharray": "3,3"}));
+        var nt = svgEl("text", {x: x + 3, y: top + 10});
+        nt.textContent = b.notes.join(", ");
+        svg.appendChild(nt);
+      }
+    });
+  }
+
+  function drawClusters() {
+    var tbody = document.getElementById("clusters");
+    while (tbody.firstChild) { tbody.removeChild(tbody.firstChild); }
+    var filter = document.getElementById("filter").value.toLowerCase();
+    var rows = data.clusters.filter(function (c) {
+      return (selected === null || c.buckets[selected]) && c.reference.toLowerCase().indexOf(filter) >= 0;
+    });
+    if (selected !== null) {
+      rows.sort(function (a, b) { return b.buckets[selected] - a.buckets[selected]; });
+    }
+    rows.forEach(function (c) {
+      var tr = el("tr", {"class": "cluster"});
+      tr.appendChild(el("td", {"class": "count"}, selected === null ? c.count : c.buckets[selected]));
+      var ref = el("td");
+      ref.appendChild(el("code", {}, c.reference));
+      tr.appendChild(ref);
+      var detail = el("tr", {"class": "detail", hidden: ""});
+      var td = el("td", {colspan: 2});
+      (c.values || []).forEach(function (v) { td.appendChild(el("div", {"class": "values"}, v)); });
+      var lines = (c.lines || []).map(function (l) { return l.line; });
+      if (c.moreLines) { lines.push("... " + c.moreLines + " more lines"); }
+      if (lines.length === 0) { lines.push("(original lines were not kept)"); }
+      td.appendChild(el("pre", {}, lines.join("\n")));
+      detail.appendChild(td);
+      tr.addEventListener("click", function () {
+        if (detail.hasAttribute("hidden")) { detail.removeAttribute("hidden"); } else { detail.setAttribute("hidden", ""); }
+      });
+      tbody.appendChild(tr);
+      tbody.appendChild(detail);
+    });
+    document.getElementById("selection").textContent = selected === null ? "" :
+      "bucket " + label(data.buckets[selected].start) + ", " + rows.length + " clusters";
+  }
+
+  function drawGaps() {
+    var tbody = document.getElementById("gaps");
+    if (data.gaps.length === 0) {
+      tbody.appendChild(el("tr")).appendChild(el("td", {colspan: 4}, "none (run with -g to find periodic patterns)"));
+      return;
+    }
+    data.gaps.forEach(function (g) {
+      var tr = el("tr");
+      tr.appendChild(el("td", {}, g.interval));
+      tr.appendChild(el("td", {"class": "count"}, g.occurrences));
+      tr.appendChild(el("td", {"class": "count"}, g.magnitude));
+      var ref = el("td");
+      ref.appendChild(el("code", {}, g.reference));
+      tr.appendChild(ref);
+      tbody.appendChild(tr);
+    });
+  }
+
+  function select(i) {
+    selected = i;
+    drawChart();
+    drawClusters();
+  }
+
+  document.getElementById("filter").addEventListener("input", drawClusters);
+  document.getElementById("all").addEventListener("click", function () { select(null); });
+  window.addEventListener("resize", drawChart);
+  drawChart();
+  drawClusters();
+  drawGaps();
+})();
+</script>
+</body>
+</html>
+`))
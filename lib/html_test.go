@@ -0,0 +1,117 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const untrustedReference = `user <script>alert("x")</script> & <b>friends</b>`
+
+// untrustedResult has a cluster whose reference and lines try to break out of the report markup
+func untrustedResult() *Result {
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	return &Result{Buckets: map[time.Time]*Bucket{
+		start: {
+			Notes:     map[string]string{"start of <a.log>": ""},
+			LineCount: 2,
+			Levels:    map[string]int{"info": 2},
+			Clusters: map[string]*Cluster{
+				untrustedReference: {
+					Reference:     untrustedReference,
+					OriginalLines: map[time.Time][]string{start: {`</script><img src=x onerror=alert(1)>`, "ok"}},
+					Count:         2,
+					Levels:        map[string]int{"info": 2},
+				},
+			},
+		},
+		start.Add(time.Minute): {
+			Notes:     map[string]string{},
+			LineCount: 0,
+			Clusters:  map[string]*Cluster{},
+		},
+	}}
+}
+
+func TestHTMLReport(t *testing.T) {
+	l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+	out := &bytes.Buffer{}
+	err := l.HTMLReport(untrustedResult(), out, HTMLOptions{
+		Title:      "<b>logs</b>",
+		Parameters: []ReportParameter{{Name: "denoise", Value: `-d "a<b"`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := out.String()
+
+	if !strings.HasPrefix(page, "<!DOCTYPE html>\n") || !strings.HasSuffix(strings.TrimSpace(page), "</html>") {
+		t.Errorf("expected a complete html document, got %q...", page[:40])
+	}
+	for _, tag := range []string{"html", "head", "title", "style", "body", "h1", "h2", "table", "thead", "tbody", "tr", "th", "td", "code", "div", "svg", "span", "button", "script"} {
+		opened := len(regexp.MustCompile("<"+tag+"[\\s>]").FindAllString(page, -1))
+		closed := strings.Count(page, "</"+tag+">")
+		if opened != closed {
+			t.Errorf("expected every <%s> to be closed, got %d opened and %d closed", tag, opened, closed)
+		}
+	}
+
+	for _, unescaped := range []string{"<b>", "<img", `alert("x")`} {
+		if strings.Contains(page, unescaped) {
+			t.Errorf("expected %s to be escaped", unescaped)
+		}
+	}
+	if !strings.Contains(page, "<title>&lt;b&gt;logs&lt;/b&gt;</title>") {
+		t.Errorf("expected an escaped title")
+	}
+	if !strings.Contains(page, "<code>-d &#34;a&lt;b&#34;</code>") {
+		t.Errorf("expected escaped parameters")
+	}
+	// the page builds its tables from the data as text
+	if strings.Contains(page, "innerHTML") {
+		t.Errorf("expected cluster text to be set as text content")
+	}
+
+	start := `<script id="data" type="application/json">`
+	i := strings.Index(page, start)
+	if i < 0 {
+		t.Fatal("expected a data script")
+	}
+	encoded := page[i+len(start):]
+	encoded = encoded[:strings.Index(encoded, "</script>")]
+	data := htmlData{}
+	err = json.Unmarshal([]byte(encoded), &data)
+	if err != nil {
+		t.Fatalf("expected the data to be json: %v", err)
+	}
+	if len(data.Buckets) != 2 || len(data.Clusters) != 1 {
+		t.Fatalf("expected 2 buckets and 1 cluster, got %+v", data)
+	}
+	c := data.Clusters[0]
+	if c.Reference != untrustedReference {
+		t.Errorf("expected the reference to round trip, got %q", c.Reference)
+	}
+	if len(c.Lines) != 2 || c.Lines[0].Line != `</script><img src=x onerror=alert(1)>` {
+		t.Errorf("expected the lines to round trip, got %+v", c.Lines)
+	}
+	if len(data.Buckets[0].Notes) != 1 || data.Buckets[0].Notes[0] != "start of <a.log>" {
+		t.Errorf("expected the notes to round trip, got %v", data.Buckets[0].Notes)
+	}
+}
+
+func TestHTMLReportMaxLines(t *testing.T) {
+	l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+	out := &bytes.Buffer{}
+	err := l.HTMLReport(untrustedResult(), out, HTMLOptions{MaxLines: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"moreLines":1`) {
+		t.Errorf("expected 1 more line than shown")
+	}
+}
@@ -0,0 +1,113 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cjnosal/logstat/pkg/datetime"
+	"github.com/cjnosal/logstat/pkg/line"
+)
+
+// InputSpec overrides how inputs whose path matches Glob are parsed
+type InputSpec struct {
+	Glob               string   `yaml:"glob"`
+	Profile            string   `yaml:"profile"`
+	DateTimeExtractors []string `yaml:"datetime"`
+	DateTimeFormats    []string `yaml:"dateformat"`
+	Timezone           string   `yaml:"timezone"`
+}
+
+type inputSpecFile struct {
+	Inputs []InputSpec `yaml:"inputs"`
+}
+
+// LoadInputSpecs reads a yaml list of input specs, e.g.
+//
+//	inputs:
+//	- glob: "*access.log*"
+//	  profile: nginx
+//	- glob: "db/*.log"
+//	  datetime: ["\\d+-\\d+-\\d+ \\d+:\\d+:\\d+ UTC"]
+//	  dateformat: ["2006-01-02 15:04:05 MST"]
+//	  timezone: America/Toronto
+func LoadInputSpecs(reader io.Reader) ([]InputSpec, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	file := inputSpecFile{}
+	err = yaml.UnmarshalStrict(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	for _, spec := range file.Inputs {
+		if spec.Glob == "" {
+			return nil, fmt.Errorf("Input spec missing glob: %+v", spec)
+		}
+	}
+	return file.Inputs, nil
+}
+
+func findInputSpec(path string, specs []InputSpec) *InputSpec {
+	for i, spec := range specs {
+		if matchesGlob(spec.Glob, path) {
+			return &specs[i]
+		}
+	}
+	return nil
+}
+
+// matchesGlob matches a glob against the whole path or its file name
+func matchesGlob(glob string, path string) bool {
+	if glob == path {
+		return true
+	}
+	if m, _ := filepath.Match(glob, path); m {
+		return true
+	}
+	m, _ := filepath.Match(glob, filepath.Base(path))
+	return m
+}
+
+// profile resolves the datetime extractors and formats of the spec
+func (spec *InputSpec) profile() (*datetime.Profile, error) {
+	profile := &datetime.Profile{
+		Name:       spec.Glob,
+		Extractors: append([]string{}, spec.DateTimeExtractors...),
+		Formats:    append([]string{}, spec.DateTimeFormats...),
+	}
+	if spec.Profile != "" {
+		p, ok := datetime.Find(spec.Profile)
+		if !ok {
+			return nil, fmt.Errorf("Unknown datetime profile %s for %s (expected one of %v)", spec.Profile, spec.Glob, datetime.Names())
+		}
+		profile.Name = p.Name
+		profile.Extractors = append(profile.Extractors, p.Extractors...)
+		profile.Formats = append(profile.Formats, p.Formats...)
+	}
+	if len(profile.Extractors) == 0 || len(profile.Formats) == 0 {
+		return nil, fmt.Errorf("Input spec for %s needs a profile or both datetime extractors and formats", spec.Glob)
+	}
+	return profile, nil
+}
+
+// newInputLineProcessor returns a line processor for the input spec matching path, if any
+func newInputLineProcessor(path string, config Config) (line.LineProcessor, *datetime.Profile, error) {
+	spec := findInputSpec(path, config.Inputs)
+	if spec == nil || (spec.Profile == "" && len(spec.DateTimeExtractors) == 0 && len(spec.DateTimeFormats) == 0) {
+		return nil, nil, nil
+	}
+	profile, err := spec.profile()
+	if err != nil {
+		return nil, nil, err
+	}
+	lp, err := newProfileLineProcessor(config, profile, path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return lp, profile, nil
+}
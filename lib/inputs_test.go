@@ -0,0 +1,172 @@
+package lib
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadInputSpecs(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		specs []InputSpec
+		err   string
+	}{
+		{
+			name: "specs",
+			yaml: `inputs:
+- glob: "*access.log*"
+  profile: nginx
+- glob: "db/*.log"
+  datetime: ['\d+\.\d+\.\d+ \d+:\d+:\d+']
+  dateformat: ["2006.01.02 15:04:05"]
+  timezone: America/Toronto
+`,
+			specs: []InputSpec{
+				{Glob: "*access.log*", Profile: "nginx"},
+				{
+					Glob:               "db/*.log",
+					DateTimeExtractors: []string{"\\d+\\.\\d+\\.\\d+ \\d+:\\d+:\\d+"},
+					DateTimeFormats:    []string{"2006.01.02 15:04:05"},
+					Timezone:           "America/Toronto",
+				},
+			},
+		},
+		{
+			name: "missing glob",
+			yaml: "inputs:\n- profile: nginx\n",
+			err:  "Input spec missing glob",
+		},
+		{
+			name: "unknown field",
+			yaml: "inputs:\n- glob: '*.log'\n  profiles: nginx\n",
+			err:  "field profiles not found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			specs, err := LoadInputSpecs(strings.NewReader(test.yaml))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(specs, test.specs) {
+				t.Errorf("expected %+v, got %+v", test.specs, specs)
+			}
+		})
+	}
+}
+
+func TestMatchesGlob(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"/var/log/app.log", "/var/log/app.log", true},
+		{"db/*.log", "db/primary.log", true},
+		{"/var/log/*/error.log", "/var/log/nginx/error.log", true},
+		{"*access.log*", "/var/log/nginx/access.log.1", true},
+		{"app-*.log", "logs/app-1.log", true},
+		{"db/*.log", "/var/log/db/primary.log", false},
+		{"*.log", "/var/log/app.log.gz", false},
+		{"[", "[", true},
+		{"[", "/var/log/[", false},
+	}
+	for _, test := range tests {
+		if matchesGlob(test.glob, test.path) != test.matches {
+			t.Errorf("%s and %s: expected matches to be %t", test.glob, test.path, test.matches)
+		}
+	}
+}
+
+func TestInputProfiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"access.log": `10.0.0.1 - - [17/Oct/2023:04:00:10 -0400] "GET / HTTP/1.1" 200 512` + "\n",
+		"db.log":     "2023.10.17 04:01:20 checkpoint complete\n",
+		"app.log":    "2023-10-17T08:02:30Z started\n",
+	}
+	paths := []string{}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		err := ioutil.WriteFile(path, []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	config := testConfig()
+	config.Inputs = []InputSpec{
+		{Glob: "access.log", Profile: "clf"},
+		{
+			Glob:               filepath.Join(dir, "db.*"),
+			DateTimeExtractors: []string{"\\d+\\.\\d+\\.\\d+ \\d+:\\d+:\\d+"},
+			DateTimeFormats:    []string{"2006.01.02 15:04:05"},
+			Timezone:           "America/Toronto",
+		},
+	}
+	lsl := NewLogStat(log.New(ioutil.Discard, "", 0))
+	result, err := lsl.ProcessFiles(paths, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]time.Time{
+		"access.log": time.Date(2023, time.October, 17, 8, 0, 10, 0, time.UTC),
+		"db.log":     time.Date(2023, time.October, 17, 8, 1, 20, 0, time.UTC),
+		"app.log":    time.Date(2023, time.October, 17, 8, 2, 30, 0, time.UTC),
+	}
+	found := map[string]time.Time{}
+	for _, bucket := range result.Buckets {
+		for _, c := range bucket.Clusters {
+			for lineTime, lines := range c.OriginalLines {
+				for _, line := range lines {
+					for name, content := range files {
+						if line == strings.TrimSpace(content) {
+							found[name] = lineTime
+						}
+					}
+				}
+			}
+		}
+	}
+	for name, lineTime := range expected {
+		if !found[name].Equal(lineTime) {
+			t.Errorf("%s: expected its line at %s, got %s", name, lineTime, found[name])
+		}
+	}
+}
+
+func TestInputProfileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		spec InputSpec
+		err  string
+	}{
+		{"unknown profile", InputSpec{Glob: "*.log", Profile: "cobol"}, "Unknown datetime profile cobol"},
+		{"formats without extractors", InputSpec{Glob: "*.log", DateTimeFormats: []string{"2006"}}, "needs a profile or both"},
+		{"invalid timezone", InputSpec{Glob: "*.log", Timezone: "Mars/Olympus"}, "Invalid timezone for app.log"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig()
+			config.Inputs = []InputSpec{test.spec}
+			_, err := newSource("app.log", "app.log", config, epoch)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
@@ -2,15 +2,23 @@ package lib
 
 import (
 	"bufio"
+	"context"
 	"fmt"
+	"hash/fnv"
 	"io"
 	"log"
 	"math"
 	"os"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/cjnosal/logstat/pkg/datetime"
+	"github.com/cjnosal/logstat/pkg/decompress"
+	"github.com/cjnosal/logstat/pkg/drain"
+	"github.com/cjnosal/logstat/pkg/level"
 	"github.com/cjnosal/logstat/pkg/line"
 )
 
@@ -18,13 +26,26 @@ var (
 	epoch = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
 )
 
+// entries each job prepares per batch when Jobs > 1
+const entriesPerJob = 512
+
 type LogStat interface {
 	ProcessFiles(logFiles []string, config Config) (*Result, error)
 	ProcessStream(reader io.Reader, config Config) (*Result, error)
-	Histogram(result *Result, out io.Writer) error
-	Buckets(result *Result, out io.Writer, showOriginalLines bool, minCount int) error
+	Follow(ctx context.Context, logFiles []string, config Config, refresh func(*Result) error) error
+	StreamPrinter(out io.Writer, showBuckets bool, showOriginalLines bool, minCount int, topValues int, histogram HistogramOptions) func(bucketStart time.Time, bucket *Bucket) error
+	Histogram(result *Result, out io.Writer, options HistogramOptions) error
+	Buckets(result *Result, out io.Writer, showOriginalLines bool, minCount int, topValues int) error
 	LastSeen(result *Result, out io.Writer, minGap *time.Duration, maxGap *time.Duration,
 		minRepetition int, maxRepetition int, minCount int, margin int) error
+	Gaps(result *Result, options GapOptions) []Gap
+	Report(result *Result, options ReportOptions) *Report
+	NDJSONStreamPrinter(out io.Writer, options ReportOptions) func(bucketStart time.Time, bucket *Bucket) error
+	CountRows(result *Result, minCount int) []CountRow
+	Table(result *Result, out io.Writer, options TableOptions) error
+	TableStreamPrinter(out io.Writer, options TableOptions) func(bucketStart time.Time, bucket *Bucket) error
+	HTMLReport(result *Result, out io.Writer, options HTMLOptions) error
+	Chart(result *Result, out io.Writer, options ChartOptions) error
 }
 
 func NewLogStat(logger *log.Logger) LogStat {
@@ -43,11 +64,61 @@ type Config struct {
 	KeepOriginalLines  bool
 	StartTime          *time.Time
 	EndTime            *time.Time
+	RelativeStartTime  *RelativeTime
+	RelativeEndTime    *RelativeTime
+	RetentionWindow    time.Duration
+	EntryStart         string
+	InputFormat        string
+	TimeField          string
+	MessageField       string
+	GroupFields        []string
+	Location           *time.Location
+	DisplayLocation    *time.Location
+	DiscoverDateTime   int
+	ClockSkewAnchors   []string
+	EstimateClockSkew  bool
+	MaxClockSkew       time.Duration
+	DateTimeProfiles   []datetime.Profile
+	Inputs             []InputSpec
+	// when set, each bucket is passed to StreamBucket in time order once the input has moved
+	// ReorderWindow past its end, and is then dropped from the Result
+	StreamBucket       func(bucketStart time.Time, bucket *Bucket) error
+	ReorderWindow      time.Duration
+	MemoryBudget       int64
+	KeepStreamedCounts bool
+	// number of goroutines parsing and denoising entries, which are then bucketed in input order
+	Jobs            int
+	ClusterEngine   string
+	DrainDepth      int
+	DrainSimilarity float64
+	// record the values replaced by denoising in Cluster.Values
+	CaptureValues bool
+	// merge clusters at least this similar by word edit distance (0 to disable)
+	FuzzyMerge float64
+	// applied after DenoisePatterns, in order, to the sources and fields they apply to
+	DenoiseRules []DenoiseRule
+	// only keep entries of these levels (e.g. error, or warn+ for warn and more severe levels)
+	Levels []string
 }
 
+const (
+	// lines with a parseable datetime start a new entry
+	EntryStartDateTime = "datetime"
+	// lines without leading whitespace start a new entry
+	EntryStartIndent = "indent"
+
+	// lines are clustered when they are identical after denoising
+	ClusterRegex = "regex"
+	// lines are clustered by templates learned from the denoised lines
+	ClusterDrain = "drain"
+)
+
 type Result struct {
 	ReferenceTime *time.Time
 	Buckets       map[time.Time]*Bucket
+	ClockOffsets  map[string]time.Duration
+
+	templates *drain.Miner
 }
 
 type Bucket struct {
@@ -55,11 +126,24 @@ type Bucket struct {
 	Clusters map[string]*Cluster
 
 	LineCount int
+	// lines by level (see pkg/level)
+	Levels map[string]int
 }
 
 type Cluster struct {
 	Reference     string
 	OriginalLines map[time.Time][]string
+	Count         int
+	// values replaced by denoising, by placeholder (or word of a drain template)
+	Values []*Values
+	// lines by level (see pkg/level)
+	Levels map[string]int
+	// lines by source file
+	Sources map[string]int
+
+	template   *drain.Group
+	lineValues map[time.Time][][]string
+	lineTags   map[time.Time][]lineTag
 }
 
 type logStat struct {
@@ -70,48 +154,205 @@ func (l *logStat) ProcessFiles(logFiles []string, config Config) (*Result, error
 	if len(logFiles) == 0 {
 		return nil, fmt.Errorf("At least one log file required")
 	}
-	lp, err := line.NewLineProcessor(config.LineFilters, config.DenoisePatterns, config.DateTimeExtractors)
-	if err != nil {
-		return nil, err
+	var err error
+	var offsets map[string]time.Duration
+	if len(logFiles) > 1 && (config.EstimateClockSkew || len(config.ClockSkewAnchors) > 0) {
+		offsets, err = l.estimateClockOffsets(logFiles, config)
+		if err != nil {
+			return nil, err
+		}
 	}
 	result := &Result{
-		Buckets: map[time.Time]*Bucket{},
+		Buckets:      map[time.Time]*Bucket{},
+		ClockOffsets: offsets,
+	}
+	if config.StreamBucket != nil {
+		return result, l.streamFiles(logFiles, config, result)
 	}
 	for _, lf := range logFiles {
-		f, e := os.Open(lf)
-		if e != nil {
-			return nil, e
-		}
-		defer f.Close()
-		bufr := bufio.NewReader(f)
-		err = l.processLines(fmt.Sprintf("start of %s", lf), bufr, lp, config, result)
+		err = l.processFile(lf, config, result, offsets[lf])
 		if err != nil {
 			return nil, err
 		}
 	}
+	applyTemplates(result)
+	applyRelativeBounds(result, config)
+	mergeSimilarClusters(result, config)
 	return result, nil
 }
 
-func (l *logStat) ProcessStream(reader io.Reader, config Config) (*Result, error) {
-	lp, err := line.NewLineProcessor(config.LineFilters, config.DenoisePatterns, config.DateTimeExtractors)
+func (l *logStat) processFile(lf string, config Config, result *Result, offset time.Duration) error {
+	in, err := openInput(lf, config, offset)
 	if err != nil {
+		return err
+	}
+	defer in.close()
+	return l.processLines(in.src, in.bufr, config, result)
+}
+
+// openInput opens and decompresses a log file, using its modification time as the reference
+// for datetimes without a year
+func openInput(lf string, config Config, offset time.Duration) (*streamInput, error) {
+	f, err := os.Open(lf)
+	if err != nil {
+		return nil, err
+	}
+	dr, _, err := decompress.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("Error decompressing %s: %v", lf, err)
+	}
+	reference := time.Now()
+	if info, e := f.Stat(); e == nil {
+		reference = info.ModTime()
+	}
+	src, err := newSource(lf, fmt.Sprintf("start of %s", lf), config, reference)
+	if err != nil {
+		dr.Close()
+		f.Close()
 		return nil, err
 	}
+	src.offset = offset
+	return &streamInput{
+		src:     src,
+		bufr:    bufio.NewReader(dr),
+		closers: []io.Closer{dr, f},
+	}, nil
+}
+
+func (l *logStat) ProcessStream(reader io.Reader, config Config) (*Result, error) {
 	result := &Result{
 		Buckets: map[time.Time]*Bucket{},
 	}
-	bufr := bufio.NewReader(reader)
-	err = l.processLines("stream", bufr, lp, config, result)
+	dr, _, err := decompress.NewReader(reader)
 	if err != nil {
 		return nil, err
 	}
+	defer dr.Close()
+	bufr := bufio.NewReader(dr)
+	src, err := newSource("stream", "stream", config, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if config.StreamBucket != nil {
+		return result, l.stream([]*streamInput{{src: src, bufr: bufr}}, config, result)
+	}
+	err = l.processLines(src, bufr, config, result)
+	if err != nil {
+		return nil, err
+	}
+	applyTemplates(result)
+	applyRelativeBounds(result, config)
+	mergeSimilarClusters(result, config)
 	return result, nil
 }
 
-func (l *logStat) processLines(tag string, bufr *bufio.Reader, lp line.LineProcessor, config Config, result *Result) error {
-	var tagRefTime *time.Time
-	var prevLineTime *time.Time
-	empty := true
+type source struct {
+	name         string
+	tag          string
+	lp           line.LineProcessor
+	formats      []string
+	location     *time.Location
+	years        *datetime.YearInferrer
+	offset       time.Duration
+	sample       []string
+	sampling     bool
+	lineFilters  []string
+	fieldFilters []*fieldFilter
+	parse        func(raw string) (*entry, error)
+	startsEntry  func(line string) bool
+	pending      []string
+	prevLineTime *time.Time
+	tagged       bool
+	kept         int64
+	batch        []string
+	capture      *valueCapture
+	denoisers    map[string]line.LineProcessor
+	levels       map[string]bool
+}
+
+func newSource(name string, tag string, config Config, reference time.Time) (*source, error) {
+	lineFilters, fieldFilters, err := splitFilters(config)
+	if err != nil {
+		return nil, err
+	}
+	spec := findInputSpec(name, config.Inputs)
+	if spec != nil && spec.Timezone != "" {
+		config.Location, err = time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid timezone for %s: %v", name, err)
+		}
+	}
+	if config.Location == nil {
+		config.Location = time.UTC
+	}
+	if config.ClusterEngine != "" && config.ClusterEngine != ClusterRegex && config.ClusterEngine != ClusterDrain {
+		return nil, fmt.Errorf("Unknown clustering engine %s", config.ClusterEngine)
+	}
+	parse, err := newEntryParser(config)
+	if err != nil {
+		return nil, err
+	}
+	lp, err := newLineProcessor(config, name)
+	if err != nil {
+		return nil, err
+	}
+	denoisers, err := newFieldDenoisers(config, name)
+	if err != nil {
+		return nil, err
+	}
+	var levels map[string]bool
+	if len(config.Levels) > 0 {
+		levels, err = level.Select(config.Levels)
+		if err != nil {
+			return nil, err
+		}
+	}
+	src := &source{
+		name:         name,
+		tag:          tag,
+		lp:           lp,
+		formats:      config.DateTimeFormats,
+		location:     config.Location,
+		years:        datetime.NewYearInferrer(reference.In(config.Location)),
+		sampling:     config.DiscoverDateTime > 0 && !structured(config),
+		lineFilters:  lineFilters,
+		fieldFilters: fieldFilters,
+		parse:        parse,
+		capture:      newValueCapture(config),
+		denoisers:    denoisers,
+		levels:       levels,
+	}
+	inputLp, profile, err := newInputLineProcessor(name, config)
+	if err != nil {
+		return nil, err
+	}
+	if inputLp != nil {
+		src.lp = inputLp
+		src.formats = profile.Formats
+		src.sampling = false
+	}
+	switch config.EntryStart {
+	case "":
+	case EntryStartDateTime:
+		src.startsEntry = func(str string) bool {
+			return src.extractTime(str) != nil
+		}
+	case EntryStartIndent:
+		src.startsEntry = func(str string) bool {
+			return !strings.HasPrefix(str, " ") && !strings.HasPrefix(str, "\t")
+		}
+	default:
+		r, err := regexp.Compile(config.EntryStart)
+		if err != nil {
+			return nil, err
+		}
+		src.startsEntry = r.MatchString
+	}
+	return src, nil
+}
+
+func (l *logStat) processLines(src *source, bufr *bufio.Reader, config Config, result *Result) error {
 	for {
 		str, err := bufr.ReadString('\n')
 		if err != nil {
@@ -121,59 +362,266 @@ func (l *logStat) processLines(tag string, bufr *bufio.Reader, lp line.LineProce
 				return err
 			}
 		}
-		str = strings.TrimSuffix(str, "\n")
-		if len(config.LineFilters) > 0 && !lp.Match(str) {
-			continue
+		l.processSourceLine(src, str, config, result)
+	}
+	l.finishSource(src, config, result)
+	return nil
+}
+
+// finishSource processes any lines held for datetime discovery or multi-line entry assembly
+func (l *logStat) finishSource(src *source, config Config, result *Result) {
+	if src.sampling {
+		l.discover(src, config, result)
+	}
+	l.flushEntry(src, config, result)
+	l.flushBatch(src, config, result)
+}
+
+func (l *logStat) processSourceLine(src *source, str string, config Config, result *Result) {
+	str = strings.TrimSuffix(str, "\n")
+	if src.sampling {
+		src.sample = append(src.sample, str)
+		if len(src.sample) >= config.DiscoverDateTime {
+			l.discover(src, config, result)
 		}
-		str = strings.TrimSpace(str)
-		if len(str) == 0 {
-			continue
+		return
+	}
+	if src.startsEntry == nil {
+		l.processEntry(src, str, config, result)
+		return
+	}
+	if len(strings.TrimSpace(str)) == 0 {
+		return
+	}
+	if len(src.pending) > 0 && src.startsEntry(str) {
+		l.flushEntry(src, config, result)
+	}
+	src.pending = append(src.pending, str)
+}
+
+func (l *logStat) flushEntry(src *source, config Config, result *Result) {
+	if len(src.pending) == 0 {
+		return
+	}
+	entry := strings.Join(src.pending, "\n")
+	src.pending = nil
+	l.processEntry(src, entry, config, result)
+}
+
+func (l *logStat) processEntry(src *source, str string, config Config, result *Result) {
+	if config.Jobs > 1 {
+		src.batch = append(src.batch, str)
+		if len(src.batch) >= config.Jobs*entriesPerJob {
+			l.flushBatch(src, config, result)
 		}
-		var bucketStart *time.Time
-		prevLineTime, bucketStart, err = l.processLine(lp, config, str, result, prevLineTime)
-		if err != nil {
-			l.logger.Println(err)
-		} else if bucketStart != nil {
-			empty = false
-			if tagRefTime == nil && prevLineTime != nil {
-				tagRefTime = bucketStart
-			}
+		return
+	}
+	e, err := src.prepareEntry(str, config)
+	l.applyEntry(src, e, err, config, result)
+}
+
+// flushBatch prepares the batched entries of a source concurrently, places them in order, then merges
+// them into their clusters concurrently, sharded by cluster so each cluster still sees its lines in order
+func (l *logStat) flushBatch(src *source, config Config, result *Result) {
+	if len(src.batch) == 0 {
+		return
+	}
+	batch := src.batch
+	src.batch = nil
+	entries := make([]*entry, len(batch))
+	errs := make([]error, len(batch))
+	parallel(len(batch), config.Jobs, func(i int) {
+		entries[i], errs[i] = src.prepareEntry(batch[i], config)
+	})
+
+	placed := make([]*placedLine, 0, len(batch))
+	for i := range batch {
+		if p := l.placeEntry(src, entries[i], errs[i], config, result); p != nil {
+			placed = append(placed, p)
 		}
 	}
-	if !empty {
-		if tagRefTime == nil {
-			tagRefTime = &epoch
+	shards := make([][]*placedLine, config.Jobs)
+	for _, p := range placed {
+		shard := int(hashKey(p.cluster.Reference) % uint32(config.Jobs))
+		shards[shard] = append(shards[shard], p)
+	}
+	parallel(len(shards), config.Jobs, func(i int) {
+		for _, p := range shards[i] {
+			p.merge(src, config)
+		}
+	})
+}
+
+// parallel calls f for each of n items, split into contiguous chunks across jobs goroutines
+func parallel(n int, jobs int, f func(i int)) {
+	chunk := (n + jobs - 1) / jobs
+	wg := sync.WaitGroup{}
+	for start := 0; start < n; start += chunk {
+		end := start + chunk
+		if end > n {
+			end = n
 		}
-		if tagRefTime != nil {
-			result.Buckets[*tagRefTime].Notes[tag] = ""
+		wg.Add(1)
+		go func(start int, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				f(i)
+			}
+		}(start, end)
+	}
+	wg.Wait()
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// prepareEntry filters, parses, extracts the datetime of and denoises an entry without changing the
+// source, so entries can be prepared concurrently. A nil entry has been filtered out.
+func (src *source) prepareEntry(str string, config Config) (*entry, error) {
+	if !structured(config) && len(src.lineFilters) > 0 && !src.lp.Match(str) {
+		return nil, nil
+	}
+	str = strings.TrimSpace(str)
+	if len(str) == 0 {
+		return nil, nil
+	}
+	e, err := src.parse(str)
+	if err != nil {
+		e = &entry{
+			raw:     str,
+			message: str,
 		}
 	}
-	return nil
+	if structured(config) && !src.matches(e) {
+		return nil, err
+	}
+	e.level = detectLevel(e)
+	if src.levels != nil && !src.levels[e.level] {
+		return nil, err
+	}
+	if e.time == nil {
+		e.time = src.extractTime(e.raw)
+	}
+	e.denoised = src.lp.Denoise(e.message)
+	e.group = src.groupPrefix(e, config)
+	if src.capture != nil && config.ClusterEngine != ClusterDrain {
+		e.labels, e.values = src.capture.capture(e.message, e.denoised)
+	}
+	return e, err
+}
+
+func (l *logStat) applyEntry(src *source, e *entry, err error, config Config, result *Result) {
+	if p := l.placeEntry(src, e, err, config, result); p != nil {
+		p.merge(src, config)
+	}
 }
 
-func (l *logStat) processLine(lp line.LineProcessor, config Config, line string, result *Result, prevLineTime *time.Time) (*time.Time, *time.Time, error) {
-	datetimes := lp.Extract(line)
-	var logtime *time.Time
-	parseErrors := []error{}
-	for _, datetime := range datetimes {
-		for _, format := range config.DateTimeFormats {
-			lt, e := time.Parse(format, datetime)
+// placeEntry finds the bucket and cluster of a prepared entry. Returns nil if the entry is not counted.
+func (l *logStat) placeEntry(src *source, e *entry, err error, config Config, result *Result) *placedLine {
+	if err != nil {
+		l.logger.Println(err)
+	}
+	if e == nil {
+		return nil
+	}
+	var p *placedLine
+	src.prevLineTime, p, err = l.processLine(src, config, e, result, src.prevLineTime)
+	if err != nil {
+		l.logger.Println(err)
+		return nil
+	}
+	if p == nil {
+		return nil
+	}
+	if !src.tagged {
+		p.bucket.Notes[src.tag] = ""
+		src.tagged = true
+	}
+	if config.KeepOriginalLines {
+		src.kept += int64(len(e.raw))
+	}
+	return p
+}
+
+// extractTime finds the first datetime in the line, leaving the year at 0 for layouts without one
+func (src *source) extractTime(line string) *time.Time {
+	for _, dt := range src.lp.Extract(line) {
+		for _, format := range src.formats {
+			lt, e := datetime.ParseInLocation(format, dt, src.location)
 			if e == nil {
-				logtime = &lt
-				break
+				return &lt
 			}
-			parseErrors = append(parseErrors, e)
 		}
-		if logtime != nil {
-			break
+	}
+	return nil
+}
+
+// discover picks the datetime profile that best matches the sampled lines, then processes them
+func (l *logStat) discover(src *source, config Config, result *Result) {
+	src.sampling = false
+	profiles := config.DateTimeProfiles
+	if len(profiles) == 0 {
+		profiles = datetime.Catalog
+	}
+	sample := src.sample
+	src.sample = nil
+
+	profile, count, err := datetime.Discover(sample, profiles)
+	if err != nil {
+		l.logger.Printf("Error discovering datetime format for %s: %v\n", src.name, err)
+	} else if profile == nil {
+		l.logger.Printf("%s: no datetime format found in %d sampled lines\n", src.name, len(sample))
+	} else {
+		lp, err := newProfileLineProcessor(config, profile, src.name)
+		if err != nil {
+			l.logger.Printf("Error applying datetime profile %s to %s: %v\n", profile.Name, src.name, err)
+		} else {
+			l.logger.Printf("%s: using %s datetimes (%s) found in %d of %d sampled lines\n",
+				src.name, profile.Name, profile.Description, count, len(sample))
+			src.lp = lp
+			src.formats = profile.Formats
 		}
 	}
+
+	for _, str := range sample {
+		l.processSourceLine(src, str, config, result)
+	}
+}
+
+// placedLine is an entry with its time, bucket and cluster, ready to be merged into the cluster
+type placedLine struct {
+	e       *entry
+	time    *time.Time
+	bucket  *Bucket
+	cluster *Cluster
+	labels  []string
+	values  []string
+}
+
+// processLine places an entry in its bucket and cluster, in the order the entries were read. The
+// bucket is counted here, the cluster only once the placed line is merged.
+func (l *logStat) processLine(src *source, config Config, e *entry, result *Result, prevLineTime *time.Time) (*time.Time, *placedLine, error) {
+	logtime := e.time
+	if logtime != nil && logtime.Year() == 0 {
+		inferred := src.years.Infer(*logtime)
+		logtime = &inferred
+	}
+	if logtime != nil && src.offset != 0 {
+		corrected := logtime.Add(src.offset)
+		logtime = &corrected
+	}
 	if result.ReferenceTime == nil {
+		rt := epoch
 		if logtime != nil {
-			result.ReferenceTime = logtime
-		} else {
-			result.ReferenceTime = &epoch
+			rt = *logtime
 		}
+		if config.DisplayLocation != nil {
+			rt = rt.In(config.DisplayLocation)
+		}
+		result.ReferenceTime = &rt
 	}
 	if logtime == nil {
 		if prevLineTime == nil {
@@ -195,7 +643,15 @@ func (l *logStat) processLine(lp line.LineProcessor, config Config, line string,
 	bucketOffset := int64(math.Floor(offset / float64(config.BucketDuration)))
 	bucketStart := result.ReferenceTime.Add(time.Duration(bucketOffset) * config.BucketDuration)
 
-	uniqueLine := lp.Denoise(line)
+	var template *drain.Group
+	uniqueLine := e.group + e.denoised + e.signature
+	if config.ClusterEngine == ClusterDrain {
+		if result.templates == nil {
+			result.templates = drain.NewMiner(config.DrainDepth, config.DrainSimilarity, drainMaxChildren)
+		}
+		template = result.templates.Add(e.denoised)
+		uniqueLine = e.group + templateMarker(template) + e.signature
+	}
 
 	bucket := result.Buckets[bucketStart]
 	if bucket == nil {
@@ -210,13 +666,37 @@ func (l *logStat) processLine(lp line.LineProcessor, config Config, line string,
 		cluster = &Cluster{
 			Reference:     uniqueLine,
 			OriginalLines: map[time.Time][]string{},
+			template:      template,
 		}
 		bucket.Clusters[uniqueLine] = cluster
 	}
 
+	p := &placedLine{
+		e:       e,
+		time:    logtime,
+		bucket:  bucket,
+		cluster: cluster,
+		labels:  e.labels,
+		values:  e.values,
+	}
+	// drain templates keep changing as lines are added, so take the values while the template is
+	// as it was for this line
+	if config.CaptureValues && template != nil {
+		p.labels, p.values = tokenValues(template, e)
+	}
+
+	bucket.LineCount++
+	bucket.Levels = addCount(bucket.Levels, e.level, 1)
+
+	return logtime, p, nil
+}
+
+// merge adds a placed line to its cluster. Lines of different clusters can be merged concurrently.
+func (p *placedLine) merge(src *source, config Config) {
+	e, logtime, cluster := p.e, p.time, p.cluster
 	clusterItem := ""
 	if config.KeepOriginalLines {
-		clusterItem = line
+		clusterItem = e.raw
 	}
 
 	clusterLines := cluster.OriginalLines[*logtime]
@@ -225,59 +705,28 @@ func (l *logStat) processLine(lp line.LineProcessor, config Config, line string,
 	}
 	clusterLines = append(clusterLines, clusterItem)
 	cluster.OriginalLines[*logtime] = clusterLines
-
-	bucket.LineCount++
-
-	return logtime, &bucketStart, nil
-}
-
-func (l *logStat) Histogram(result *Result, out io.Writer) error {
-	bucketTimes := make(timeSlice, len(result.Buckets))
-	i := 0
-	minCount := 1<<32 - 1
-	maxCount := 0
-	for k, bucket := range result.Buckets {
-		bucketTimes[i] = k
-		i++
-
-		if bucket.LineCount > maxCount {
-			maxCount = bucket.LineCount
-		}
-		if bucket.LineCount < minCount {
-			minCount = bucket.LineCount
+	cluster.Count++
+	cluster.Levels = addCount(cluster.Levels, e.level, 1)
+	cluster.Sources = addCount(cluster.Sources, src.name, 1)
+	if config.RelativeStartTime != nil || config.RelativeEndTime != nil {
+		if cluster.lineTags == nil {
+			cluster.lineTags = map[time.Time][]lineTag{}
 		}
+		cluster.lineTags[*logtime] = append(cluster.lineTags[*logtime], lineTag{
+			level:  e.level,
+			source: src.name,
+		})
 	}
-	sort.Sort(bucketTimes)
-
-	scale := maxCount - minCount
-	desiredScale := 40
-
-	for _, startTime := range bucketTimes {
-		bucket := result.Buckets[startTime]
-		for note := range bucket.Notes {
-			out.Write([]byte(fmt.Sprintf("  %s\n", note)))
-		}
 
-		bar := bucket.LineCount
-		if maxCount > desiredScale {
-			// offset
-			bar -= minCount - 1
-		}
-		if scale > desiredScale {
-			// squish
-			bar = (int)((float64(bar) / float64(scale)) * float64(desiredScale))
+	if config.CaptureValues {
+		cluster.addValues(p.labels, p.values)
+		if config.RelativeStartTime != nil || config.RelativeEndTime != nil {
+			cluster.keepLineValues(*logtime, p.values)
 		}
-
-		out.Write([]byte(fmt.Sprintf("%s: ", startTime)))
-		for j := 0; j < bar; j = j + 1 {
-			out.Write([]byte("*"))
-		}
-		out.Write([]byte(fmt.Sprintf(" %d\n", bucket.LineCount)))
 	}
-	return nil
 }
 
-func (l *logStat) Buckets(result *Result, out io.Writer, showOriginalLines bool, minCount int) error {
+func (l *logStat) Buckets(result *Result, out io.Writer, showOriginalLines bool, minCount int, topValues int) error {
 	outLog := log.New(out, "", 0)
 
 	bucketTimes := make(timeSlice, len(result.Buckets))
@@ -289,80 +738,126 @@ func (l *logStat) Buckets(result *Result, out io.Writer, showOriginalLines bool,
 	sort.Sort(bucketTimes)
 
 	for _, startTime := range bucketTimes {
-		header := fmt.Sprintf("%s:\n", startTime)
 		bucket := result.Buckets[startTime]
+		header := fmt.Sprintf("%s:\n", startTime)
 		for note := range bucket.Notes {
 			header += fmt.Sprintf("  %s\n", note)
 		}
-		empty := true
+		writeBucket(outLog, header, bucket, showOriginalLines, minCount, topValues)
+	}
 
-		for l, c := range bucket.Clusters {
-			sum := 0
-			for _, lines := range c.OriginalLines {
-				sum += len(lines)
+	return nil
+}
+
+// writeBucket prints the header followed by the clusters of a bucket with at least minCount lines
+// and the topValues most common values of each of their placeholders
+func writeBucket(outLog *log.Logger, header string, bucket *Bucket, showOriginalLines bool, minCount int, topValues int) {
+	empty := true
+
+	for l, c := range bucket.Clusters {
+		if c.Count >= minCount {
+			if empty {
+				outLog.Println(header)
+				empty = false
 			}
-			if sum >= minCount {
-				if empty {
-					outLog.Println(header)
-					empty = false
+			outLog.Printf("  %4d %s\n", c.Count, indentContinuation(l, 7))
+			if topValues > 0 {
+				for _, v := range c.Values {
+					if v != nil {
+						outLog.Printf("         %s\n", summarizeValues(v, topValues))
+					}
 				}
-				outLog.Printf("  %4d %s\n", sum, l)
 			}
 		}
-		if !empty {
-			outLog.Printf("\n")
-		}
+	}
+	if !empty {
+		outLog.Printf("\n")
+	}
 
-		if showOriginalLines {
-			lineTimes := make(timeSlice, bucket.LineCount)
-			j := 0
+	if showOriginalLines {
+		lineTimes := make(timeSlice, bucket.LineCount)
+		j := 0
+		for _, c := range bucket.Clusters {
+			for k := range c.OriginalLines {
+				lineTimes[j] = k
+				j++
+			}
+		}
+		sort.Sort(lineTimes)
+		prevTime := time.Time{}
+		for _, lineTime := range lineTimes {
+			if lineTime == prevTime {
+				continue
+			}
+			prevTime = lineTime
 			for _, c := range bucket.Clusters {
-				for k := range c.OriginalLines {
-					lineTimes[j] = k
-					j++
+				if c.Count < minCount {
+					continue
 				}
-			}
-			sort.Sort(lineTimes)
-			prevTime := time.Time{}
-			for _, lineTime := range lineTimes {
-				if lineTime == prevTime {
+				clusterLines := c.OriginalLines[lineTime]
+				if clusterLines == nil {
 					continue
 				}
-				prevTime = lineTime
-				for _, c := range bucket.Clusters {
-					sum := 0
-					for _, lines := range c.OriginalLines {
-						sum += len(lines)
-					}
-					if sum < minCount {
-						continue
-					}
-					clusterLines := c.OriginalLines[lineTime]
-					if clusterLines == nil {
-						continue
-					}
-					for _, line := range clusterLines { // logging by cluster, not original order
-						outLog.Printf("  %s\n", line)
-					}
+				for _, line := range clusterLines { // logging by cluster, not original order
+					outLog.Printf("  %s\n", indentContinuation(line, 2))
 				}
 			}
-			if !empty {
-				outLog.Printf("\n")
-			}
+		}
+		if !empty {
+			outLog.Printf("\n")
 		}
 	}
+}
 
-	return nil
+// indentContinuation aligns the continuation lines of multi-line entries
+func indentContinuation(entry string, indent int) string {
+	return strings.Replace(entry, "\n", "\n"+strings.Repeat(" ", indent), -1)
 }
 
 type Occurrences struct {
 	repsByMagnitude map[int]int
 }
 
+// GapOptions select the gaps between recurring clusters. Clusters recur when a later bucket has
+// within Margin as many lines; recurrences are counted by gap and magnitude (the smaller count,
+// rounded down to a multiple of Margin).
+type GapOptions struct {
+	MinGap        *time.Duration
+	MaxGap        *time.Duration
+	MinRepetition int
+	MaxRepetition int
+	MinCount      int
+	Margin        int
+}
+
+// Gap is a cluster that recurred Occurrences times after Interval with Magnitude lines
+type Gap struct {
+	Interval    time.Duration
+	Occurrences int
+	Magnitude   int
+	Reference   string
+}
+
 func (l *logStat) LastSeen(result *Result, out io.Writer, minGap *time.Duration, maxGap *time.Duration,
 	minRepetition int, maxRepetition int, minCount int, margin int) error {
 	outLog := log.New(out, "", 0)
+	gaps := l.Gaps(result, GapOptions{
+		MinGap:        minGap,
+		MaxGap:        maxGap,
+		MinRepetition: minRepetition,
+		MaxRepetition: maxRepetition,
+		MinCount:      minCount,
+		Margin:        margin,
+	})
+	for _, g := range gaps {
+		outLog.Printf("%s %3d occurrences of magnitude %3d: %s\n", g.Interval, g.Occurrences, g.Magnitude, g.Reference)
+	}
+	return nil
+}
 
+// Gaps finds clusters that recur at regular intervals, ordered by interval, reference and magnitude
+func (l *logStat) Gaps(result *Result, options GapOptions) []Gap {
+	margin := options.Margin
 	bucketTimes := make(timeSlice, len(result.Buckets))
 	i := 0
 	for k := range result.Buckets {
@@ -374,19 +869,13 @@ func (l *logStat) LastSeen(result *Result, out io.Writer, minGap *time.Duration,
 	gaps := map[time.Duration]map[string]*Occurrences{}
 	for i, startTime := range bucketTimes {
 		for ref, cluster := range result.Buckets[startTime].Clusters {
-			sum := 0
-			for _, lines := range cluster.OriginalLines {
-				sum += len(lines)
-			}
+			sum := cluster.Count
 
 			for j := i - 1; j >= 0; j-- {
 				match := result.Buckets[bucketTimes[j]].Clusters[ref]
 
 				if match != nil {
-					matchsum := 0
-					for _, lines := range match.OriginalLines {
-						matchsum += len(lines)
-					}
+					matchsum := match.Count
 
 					if int(math.Abs(float64(matchsum-sum))) <= margin {
 						gap := startTime.Sub(bucketTimes[j])
@@ -414,35 +903,41 @@ func (l *logStat) LastSeen(result *Result, out io.Writer, minGap *time.Duration,
 			}
 		}
 	}
-	gapLengths := make(durationSlice, len(gaps))
-	i = 0
-	for k := range gaps {
-		gapLengths[i] = k
-		i++
-	}
-	sort.Sort(gapLengths)
-
-	for _, d := range gapLengths {
-		if (minGap != nil && d < *minGap) || (maxGap != nil && d > *maxGap) {
+	found := []Gap{}
+	for d, grouping := range gaps {
+		if (options.MinGap != nil && d < *options.MinGap) || (options.MaxGap != nil && d > *options.MaxGap) {
 			continue
 		}
-		for ref, occurrences := range gaps[d] {
+		for ref, occurrences := range grouping {
 			for index, reps := range occurrences.repsByMagnitude {
-				if (minRepetition > 0 && reps < minRepetition) || (maxRepetition > 0 && reps > maxRepetition) {
+				if (options.MinRepetition > 0 && reps < options.MinRepetition) || (options.MaxRepetition > 0 && reps > options.MaxRepetition) {
 					continue
 				}
 				magnitude := index
 				if margin > 0 {
 					magnitude = magnitude * margin
 				}
-				if magnitude >= minCount {
-					outLog.Printf("%s %3d occurrences of magnitude %3d: %s\n", d, reps, magnitude, ref)
+				if magnitude >= options.MinCount {
+					found = append(found, Gap{
+						Interval:    d,
+						Occurrences: reps,
+						Magnitude:   magnitude,
+						Reference:   ref,
+					})
 				}
 			}
 		}
 	}
-
-	return nil
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Interval != found[j].Interval {
+			return found[i].Interval < found[j].Interval
+		}
+		if found[i].Reference != found[j].Reference {
+			return found[i].Reference < found[j].Reference
+		}
+		return found[i].Magnitude < found[j].Magnitude
+	})
+	return found
 }
 
 type timeSlice []time.Time
@@ -0,0 +1,299 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/datetime"
+)
+
+// generateLog writes lines of a few message shapes over about an hour, with a stack trace after
+// every 50th line
+func generateLog(lines int) string {
+	b := &strings.Builder{}
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	for i := 0; i < lines; i++ {
+		t := start.Add(time.Duration(i) * 3600 * time.Second / time.Duration(lines)).Format("2006-01-02T15:04:05.000Z")
+		switch i % 5 {
+		case 0:
+			fmt.Fprintf(b, "%s INFO user %d logged in from 10.0.%d.%d\n", t, i%97, i%7, i%250)
+		case 1:
+			fmt.Fprintf(b, "%s INFO GET /api/users/%d took %dms\n", t, i%113, i%300)
+		case 2:
+			fmt.Fprintf(b, "%s WARN cache miss for key session-%x\n", t, i*7919)
+		case 3:
+			fmt.Fprintf(b, "%s DEBUG worker %d processed batch %d of %d items\n", t, i%8, i, i%40)
+		default:
+			fmt.Fprintf(b, "%s ERROR request %08x failed: connection reset by peer\n", t, i*104729)
+		}
+		if i%50 == 0 {
+			fmt.Fprintf(b, "java.lang.IllegalStateException: bad state %d\n\tat com.example.Foo.bar(Foo.java:%d)\n\tat com.example.Main.main(Main.java:7)\n", i, i%90)
+		}
+	}
+	return b.String()
+}
+
+func testConfig() Config {
+	rules, err := DenoiseRules(nil, nil, "*")
+	if err != nil {
+		panic(err)
+	}
+	patterns := [][]string{}
+	for _, e := range datetime.ISO.Extractors {
+		patterns = append(patterns, []string{e, DateReplacement})
+	}
+	return Config{
+		DateTimeExtractors: datetime.ISO.Extractors,
+		DateTimeFormats:    datetime.ISO.Formats,
+		DenoisePatterns:    patterns,
+		DenoiseRules:       rules,
+		NoiseReplacement:   "*",
+		BucketDuration:     time.Minute,
+		KeepOriginalLines:  true,
+		Location:           time.UTC,
+		Jobs:               1,
+	}
+}
+
+func process(t testing.TB, input string, config Config) *Result {
+	lsl := NewLogStat(log.New(ioutil.Discard, "", 0))
+	result, err := lsl.ProcessStream(strings.NewReader(input), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestJobsMatchSingleJob(t *testing.T) {
+	input := generateLog(2000)
+	tests := []struct {
+		name   string
+		config func(c *Config)
+	}{
+		{"lines", func(c *Config) {}},
+		{"multi-line entries", func(c *Config) { c.EntryStart = EntryStartDateTime }},
+		{"drain", func(c *Config) { c.ClusterEngine = ClusterDrain }},
+		{"drain multi-line entries", func(c *Config) {
+			c.ClusterEngine = ClusterDrain
+			c.EntryStart = EntryStartDateTime
+		}},
+		{"values", func(c *Config) { c.CaptureValues = true }},
+		{"levels", func(c *Config) { c.Levels = []string{"warn+"} }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig()
+			test.config(&config)
+			expected := process(t, input, config)
+			if len(expected.Buckets) == 0 {
+				t.Fatal("expected buckets")
+			}
+			for _, jobs := range []int{2, 4, 8} {
+				config.Jobs = jobs
+				actual := process(t, input, config)
+				if !reflect.DeepEqual(expected, actual) {
+					t.Errorf("result with %d jobs differs from the result with 1 job", jobs)
+				}
+			}
+		})
+	}
+}
+
+// entries returns the original lines of every cluster of a result, sorted
+func entries(result *Result) []string {
+	lines := []string{}
+	for _, bucket := range result.Buckets {
+		for _, c := range bucket.Clusters {
+			for _, original := range c.OriginalLines {
+				lines = append(lines, original...)
+			}
+		}
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestEntryStart(t *testing.T) {
+	tests := []struct {
+		name       string
+		entryStart string
+		input      []string
+		entries    []string
+	}{
+		{
+			name:       "continuation lines",
+			entryStart: EntryStartDateTime,
+			input: []string{
+				"2023-10-17T04:00:00Z failed: bad state",
+				"\tat com.example.Foo.bar(Foo.java:42)",
+				"Caused by: java.io.IOException",
+				"2023-10-17T04:00:01Z ok",
+			},
+			entries: []string{
+				"2023-10-17T04:00:00Z failed: bad state\n\tat com.example.Foo.bar(Foo.java:42)\nCaused by: java.io.IOException",
+				"2023-10-17T04:00:01Z ok",
+			},
+		},
+		{
+			name:       "trailing entry",
+			entryStart: EntryStartDateTime,
+			input: []string{
+				"2023-10-17T04:00:00Z ok",
+				"2023-10-17T04:00:01Z failed: bad state",
+				"\tat com.example.Foo.bar(Foo.java:42)",
+			},
+			entries: []string{
+				"2023-10-17T04:00:00Z ok",
+				"2023-10-17T04:00:01Z failed: bad state\n\tat com.example.Foo.bar(Foo.java:42)",
+			},
+		},
+		{
+			name:       "first line does not start an entry",
+			entryStart: EntryStartDateTime,
+			input: []string{
+				"\tat com.example.Foo.bar(Foo.java:42)",
+				"\tat com.example.Main.main(Main.java:7)",
+				"2023-10-17T04:00:00Z ok",
+			},
+			entries: []string{
+				"2023-10-17T04:00:00Z ok",
+				"at com.example.Foo.bar(Foo.java:42)\n\tat com.example.Main.main(Main.java:7)",
+			},
+		},
+		{
+			name:       "indent",
+			entryStart: EntryStartIndent,
+			input: []string{
+				"2023-10-17T04:00:00Z failed:",
+				"  bad state",
+				"",
+				"  at Foo.bar",
+				"2023-10-17T04:00:01Z ok",
+			},
+			entries: []string{
+				"2023-10-17T04:00:00Z failed:\n  bad state\n  at Foo.bar",
+				"2023-10-17T04:00:01Z ok",
+			},
+		},
+		{
+			name:       "regex",
+			entryStart: "^\\d{4}-",
+			input: []string{
+				"2023-10-17T04:00:00Z failed:",
+				"bad state",
+				"2023-10-17T04:00:01Z ok",
+				"done",
+			},
+			entries: []string{
+				"2023-10-17T04:00:00Z failed:\nbad state",
+				"2023-10-17T04:00:01Z ok\ndone",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig()
+			config.EntryStart = test.entryStart
+			result := process(t, strings.Join(test.input, "\n")+"\n", config)
+			actual := entries(result)
+			if !reflect.DeepEqual(actual, test.entries) {
+				t.Errorf("expected entries %q, got %q", test.entries, actual)
+			}
+		})
+	}
+}
+
+func TestTimezones(t *testing.T) {
+	edt := time.FixedZone("EDT", -4*3600)
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		location  *time.Location
+		display   *time.Location
+		input     string
+		reference time.Time
+		// location of the reference and bucket times
+		shown *time.Location
+	}{
+		{
+			name:      "timezone",
+			location:  edt,
+			input:     "2023-10-17T04:00:30 started\n2023-10-17T04:01:30Z listening\n",
+			reference: time.Date(2023, time.October, 17, 8, 0, 30, 0, time.UTC),
+			shown:     edt,
+		},
+		{
+			name:      "offsets win over the timezone",
+			location:  edt,
+			input:     "2023-10-17T04:00:30Z started\n",
+			reference: time.Date(2023, time.October, 17, 4, 0, 30, 0, time.UTC),
+			shown:     time.UTC,
+		},
+		{
+			name:      "display timezone",
+			location:  time.UTC,
+			display:   toronto,
+			input:     "2023-10-17T04:00:30Z started\n2023-10-17T04:01:30Z listening\n",
+			reference: time.Date(2023, time.October, 17, 4, 0, 30, 0, time.UTC),
+			shown:     toronto,
+		},
+		{
+			name:      "display timezone without a first datetime",
+			location:  time.UTC,
+			display:   toronto,
+			input:     "starting\n2023-10-17T04:00:30Z started\n",
+			reference: epoch,
+			shown:     toronto,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig()
+			config.Location = test.location
+			config.DisplayLocation = test.display
+			result := process(t, test.input, config)
+			if !result.ReferenceTime.Equal(test.reference) || result.ReferenceTime.Location() != test.shown {
+				t.Errorf("expected the reference time %s in %s, got %s", test.reference, test.shown, result.ReferenceTime)
+			}
+			for bucketStart := range result.Buckets {
+				if bucketStart.Location() != test.shown {
+					t.Errorf("expected bucket times in %s, got %s", test.shown, bucketStart)
+				}
+			}
+		})
+	}
+}
+
+// benchmarkJobs processes a log with the given number of jobs. Preparing entries and merging them into
+// their clusters are spread across the jobs, so with as many cpus as jobs the time per op should drop
+// (e.g. go test -bench Jobs -cpu 8 ./lib).
+func benchmarkJobs(b *testing.B, jobs int, captureValues bool) {
+	input := generateLog(20000)
+	config := testConfig()
+	config.Jobs = jobs
+	config.CaptureValues = captureValues
+	b.SetBytes(int64(len(input)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		process(b, input, config)
+	}
+}
+
+func BenchmarkProcessStreamJobs1(b *testing.B) { benchmarkJobs(b, 1, false) }
+func BenchmarkProcessStreamJobs2(b *testing.B) { benchmarkJobs(b, 2, false) }
+func BenchmarkProcessStreamJobs4(b *testing.B) { benchmarkJobs(b, 4, false) }
+func BenchmarkProcessStreamJobs8(b *testing.B) { benchmarkJobs(b, 8, false) }
+
+func BenchmarkProcessStreamValuesJobs1(b *testing.B) { benchmarkJobs(b, 1, true) }
+func BenchmarkProcessStreamValuesJobs2(b *testing.B) { benchmarkJobs(b, 2, true) }
+func BenchmarkProcessStreamValuesJobs4(b *testing.B) { benchmarkJobs(b, 4, true) }
+func BenchmarkProcessStreamValuesJobs8(b *testing.B) { benchmarkJobs(b, 8, true) }
@@ -0,0 +1,192 @@
+package lib
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+type mergeGroup struct {
+	tokens  []string
+	members []string
+}
+
+// mergeSimilarClusters merges clusters, across all buckets, whose references are at least
+// config.FuzzyMerge similar by word edit distance. The merged reference replaces the words that
+// differ with config.NoiseReplacement, and the merged cluster keeps the lines of every member.
+func mergeSimilarClusters(result *Result, config Config) {
+	if config.FuzzyMerge <= 0 {
+		return
+	}
+	wildcard := config.NoiseReplacement
+	if wildcard == "" {
+		wildcard = "*"
+	}
+
+	counts := map[string]int{}
+	for _, bucket := range result.Buckets {
+		for ref, c := range bucket.Clusters {
+			counts[ref] += c.Count
+		}
+	}
+	refs := []string{}
+	for ref := range counts {
+		refs = append(refs, ref)
+	}
+	// the most common references seed the groups
+	sort.Slice(refs, func(i, j int) bool {
+		if counts[refs[i]] != counts[refs[j]] {
+			return counts[refs[i]] > counts[refs[j]]
+		}
+		return refs[i] < refs[j]
+	})
+
+	groups := []*mergeGroup{}
+	for _, ref := range refs {
+		tokens := strings.Split(ref, " ")
+		var match *mergeGroup
+		for _, g := range groups {
+			if similarity(g.tokens, tokens, wildcard) >= config.FuzzyMerge {
+				match = g
+				break
+			}
+		}
+		if match == nil {
+			groups = append(groups, &mergeGroup{
+				tokens:  tokens,
+				members: []string{ref},
+			})
+			continue
+		}
+		match.tokens = alignTokens(match.tokens, tokens, wildcard)
+		match.members = append(match.members, ref)
+	}
+
+	merged := map[string]string{}
+	for _, g := range groups {
+		for _, ref := range g.members {
+			merged[ref] = strings.Join(g.tokens, " ")
+		}
+	}
+	for bucketStart, bucket := range result.Buckets {
+		result.Buckets[bucketStart] = mergeBucket(bucket, merged)
+	}
+}
+
+func mergeBucket(bucket *Bucket, merged map[string]string) *Bucket {
+	mergedBucket := &Bucket{
+		Notes:     bucket.Notes,
+		Clusters:  map[string]*Cluster{},
+		LineCount: bucket.LineCount,
+		Levels:    bucket.Levels,
+	}
+	refs := []string{}
+	for ref := range bucket.Clusters {
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	for _, ref := range refs {
+		c := bucket.Clusters[ref]
+		key := merged[ref]
+		m := mergedBucket.Clusters[key]
+		if m == nil {
+			m = &Cluster{
+				Reference:     key,
+				OriginalLines: map[time.Time][]string{},
+			}
+			mergedBucket.Clusters[key] = m
+		}
+		m.mergeValues(c)
+		for t, lines := range c.OriginalLines {
+			m.OriginalLines[t] = append(m.OriginalLines[t], lines...)
+		}
+		m.Count += c.Count
+		m.mergeCounts(c)
+	}
+	return mergedBucket
+}
+
+// samePlaceholders reports whether the values of two clusters line up by placeholder
+func samePlaceholders(a []*Values, b []*Values) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if (a[i] == nil) != (b[i] == nil) || (a[i] != nil && a[i].Placeholder != b[i].Placeholder) {
+			return false
+		}
+	}
+	return true
+}
+
+// similarity is 1 minus the word edit distance relative to the longer sequence, where a wildcard
+// matches any word
+func similarity(a []string, b []string, wildcard string) float64 {
+	longest := len(a)
+	if len(b) > longest {
+		longest = len(b)
+	}
+	if longest == 0 {
+		return 1
+	}
+	d := editDistances(a, b, wildcard)
+	return 1 - float64(d[len(a)][len(b)])/float64(longest)
+}
+
+func editDistances(a []string, b []string, wildcard string) [][]int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] || a[i-1] == wildcard {
+				cost = 0
+			}
+			d[i][j] = min(d[i-1][j-1]+cost, d[i-1][j]+1, d[i][j-1]+1)
+		}
+	}
+	return d
+}
+
+// alignTokens combines two word sequences, replacing substituted, inserted and deleted words with
+// a single wildcard
+func alignTokens(a []string, b []string, wildcard string) []string {
+	d := editDistances(a, b, wildcard)
+	reversed := []string{}
+	add := func(token string) {
+		if token == wildcard && len(reversed) > 0 && reversed[len(reversed)-1] == wildcard {
+			return
+		}
+		reversed = append(reversed, token)
+	}
+	i, j := len(a), len(b)
+	for i > 0 || j > 0 {
+		switch {
+		case i > 0 && j > 0 && (a[i-1] == b[j-1] || a[i-1] == wildcard) && d[i][j] == d[i-1][j-1]:
+			add(a[i-1])
+			i--
+			j--
+		case i > 0 && j > 0 && d[i][j] == d[i-1][j-1]+1:
+			add(wildcard)
+			i--
+			j--
+		case i > 0 && d[i][j] == d[i-1][j]+1:
+			add(wildcard)
+			i--
+		default:
+			add(wildcard)
+			j--
+		}
+	}
+	tokens := make([]string, len(reversed))
+	for k, token := range reversed {
+		tokens[len(reversed)-1-k] = token
+	}
+	return tokens
+}
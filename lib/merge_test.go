@@ -0,0 +1,137 @@
+package lib
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlignTokens(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		aligned  string
+		distance int
+	}{
+		{"user alice logged in", "user alice logged in", "user alice logged in", 0},
+		{"user alice logged in", "user bob logged in", "user * logged in", 1},
+		{"request failed", "request failed twice", "request failed *", 1},
+		{"request failed twice", "request failed", "request failed *", 1},
+		{"copied a b to c", "copied x y to c", "copied * to c", 2},
+		{"user * logged in", "user carol logged in", "user * logged in", 0},
+	}
+	for _, test := range tests {
+		a, b := strings.Split(test.a, " "), strings.Split(test.b, " ")
+		aligned := strings.Join(alignTokens(a, b, "*"), " ")
+		if aligned != test.aligned {
+			t.Errorf("%q and %q: expected %q, got %q", test.a, test.b, test.aligned, aligned)
+		}
+		d := editDistances(a, b, "*")
+		if d[len(a)][len(b)] != test.distance {
+			t.Errorf("%q and %q: expected distance %d, got %d", test.a, test.b, test.distance, d[len(a)][len(b)])
+		}
+	}
+}
+
+func TestMergeSimilarClusters(t *testing.T) {
+	first := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	second := first.Add(time.Minute)
+	newResult := func() *Result {
+		return &Result{Buckets: map[time.Time]*Bucket{
+			first: {
+				Notes:     map[string]string{},
+				LineCount: 5,
+				Clusters: map[string]*Cluster{
+					"user alice logged in": {
+						Reference:     "user alice logged in",
+						OriginalLines: map[time.Time][]string{first: {"user alice logged in", "user alice logged in"}},
+						Count:         2,
+						Levels:        map[string]int{"info": 2},
+						Sources:       map[string]int{"a.log": 2},
+					},
+					"user bob logged in": {
+						Reference:     "user bob logged in",
+						OriginalLines: map[time.Time][]string{first.Add(time.Second): {"user bob logged in"}},
+						Count:         1,
+						Levels:        map[string]int{"warn": 1},
+						Sources:       map[string]int{"b.log": 1},
+					},
+					"disk full": {
+						Reference:     "disk full",
+						OriginalLines: map[time.Time][]string{first: {"disk full", "disk full"}},
+						Count:         2,
+						Levels:        map[string]int{"error": 2},
+						Sources:       map[string]int{"a.log": 2},
+					},
+				},
+			},
+			second: {
+				Notes:     map[string]string{},
+				LineCount: 1,
+				Clusters: map[string]*Cluster{
+					"user carol logged in": {
+						Reference:     "user carol logged in",
+						OriginalLines: map[time.Time][]string{second: {"user carol logged in"}},
+						Count:         1,
+						Levels:        map[string]int{"info": 1},
+						Sources:       map[string]int{"b.log": 1},
+					},
+				},
+			},
+		}}
+	}
+
+	t.Run("at the threshold", func(t *testing.T) {
+		result := newResult()
+		config := testConfig()
+		config.FuzzyMerge = 0.75
+		config.NoiseReplacement = "*"
+		mergeSimilarClusters(result, config)
+
+		clusters := result.Buckets[first].Clusters
+		if len(clusters) != 2 || clusters["disk full"] == nil {
+			t.Fatalf("expected the users to be merged apart from disk full, got %v", clusters)
+		}
+		merged := clusters["user * logged in"]
+		if merged == nil {
+			t.Fatalf("expected a user * logged in cluster, got %v", clusters)
+		}
+		if merged.Reference != "user * logged in" || merged.Count != 3 {
+			t.Errorf("expected 3 lines of user * logged in, got %d of %q", merged.Count, merged.Reference)
+		}
+		expectedLines := map[time.Time][]string{
+			first:                  {"user alice logged in", "user alice logged in"},
+			first.Add(time.Second): {"user bob logged in"},
+		}
+		if !reflect.DeepEqual(merged.OriginalLines, expectedLines) {
+			t.Errorf("expected lines %v, got %v", expectedLines, merged.OriginalLines)
+		}
+		if !reflect.DeepEqual(merged.Levels, map[string]int{"info": 2, "warn": 1}) {
+			t.Errorf("expected the levels of both clusters, got %v", merged.Levels)
+		}
+		if !reflect.DeepEqual(merged.Sources, map[string]int{"a.log": 2, "b.log": 1}) {
+			t.Errorf("expected the sources of both clusters, got %v", merged.Sources)
+		}
+		if result.Buckets[first].LineCount != 5 {
+			t.Errorf("expected the bucket line count to be kept, got %d", result.Buckets[first].LineCount)
+		}
+
+		// the same merged reference across buckets
+		later := result.Buckets[second].Clusters["user * logged in"]
+		if later == nil || later.Count != 1 {
+			t.Errorf("expected user carol to be merged in the second bucket, got %v", result.Buckets[second].Clusters)
+		}
+	})
+
+	t.Run("below the threshold", func(t *testing.T) {
+		result := newResult()
+		config := testConfig()
+		config.FuzzyMerge = 0.8
+		mergeSimilarClusters(result, config)
+
+		if !reflect.DeepEqual(result, newResult()) {
+			t.Errorf("expected dissimilar clusters to be left alone, got %v", result.Buckets[first].Clusters)
+		}
+	})
+}
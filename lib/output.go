@@ -0,0 +1,202 @@
+package lib
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"time"
+)
+
+// ReportVersion is the version of the json and ndjson output schema (see README). It changes when a
+// field is removed or changes meaning; new fields may be added without changing it.
+const ReportVersion = 1
+
+const (
+	RecordBucket = "bucket"
+	RecordGap    = "gap"
+)
+
+// Report is the json output of a Result
+type Report struct {
+	Version int            `json:"version"`
+	Buckets []BucketReport `json:"buckets"`
+	Gaps    []GapReport    `json:"gaps,omitempty"`
+}
+
+type BucketReport struct {
+	Start     time.Time       `json:"start"`
+	LineCount int             `json:"lineCount"`
+	Notes     []string        `json:"notes,omitempty"`
+	Levels    map[string]int  `json:"levels,omitempty"`
+	Clusters  []ClusterReport `json:"clusters"`
+}
+
+type ClusterReport struct {
+	Reference string         `json:"reference"`
+	Count     int            `json:"count"`
+	Levels    map[string]int `json:"levels,omitempty"`
+	Sources   map[string]int `json:"sources,omitempty"`
+	Values    []ValueSummary `json:"values,omitempty"`
+	Lines     []LineReport   `json:"lines,omitempty"`
+}
+
+type LineReport struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+}
+
+type GapReport struct {
+	Interval        string  `json:"interval"`
+	IntervalSeconds float64 `json:"intervalSeconds"`
+	Occurrences     int     `json:"occurrences"`
+	Magnitude       int     `json:"magnitude"`
+	Reference       string  `json:"reference"`
+}
+
+// ReportOptions select what a Report includes. Gaps are only included when Gaps is set.
+type ReportOptions struct {
+	ShowOriginalLines bool
+	MinCount          int
+	TopValues         int
+	Gaps              *GapOptions
+}
+
+// record is a line of ndjson output, a bucket or a gap tagged with its type and the schema version
+type record struct {
+	Version int    `json:"version"`
+	Type    string `json:"type"`
+	*BucketReport
+	*GapReport
+}
+
+func (l *logStat) Report(result *Result, options ReportOptions) *Report {
+	report := &Report{
+		Version: ReportVersion,
+		Buckets: []BucketReport{},
+	}
+	bucketTimes := make(timeSlice, 0, len(result.Buckets))
+	for k := range result.Buckets {
+		bucketTimes = append(bucketTimes, k)
+	}
+	sort.Sort(bucketTimes)
+	for _, startTime := range bucketTimes {
+		report.Buckets = append(report.Buckets, bucketReport(startTime, result.Buckets[startTime], options))
+	}
+	if options.Gaps != nil {
+		report.Gaps = []GapReport{}
+		for _, g := range l.Gaps(result, *options.Gaps) {
+			report.Gaps = append(report.Gaps, gapReport(g))
+		}
+	}
+	return report
+}
+
+// bucketReport lists the clusters of a bucket with at least MinCount lines, most common first
+func bucketReport(startTime time.Time, bucket *Bucket, options ReportOptions) BucketReport {
+	br := BucketReport{
+		Start:     startTime,
+		LineCount: bucket.LineCount,
+		Levels:    bucket.Levels,
+		Clusters:  []ClusterReport{},
+	}
+	for note := range bucket.Notes {
+		br.Notes = append(br.Notes, note)
+	}
+	sort.Strings(br.Notes)
+	for ref, c := range bucket.Clusters {
+		if c.Count < options.MinCount {
+			continue
+		}
+		cr := ClusterReport{
+			Reference: ref,
+			Count:     c.Count,
+			Levels:    c.Levels,
+			Sources:   c.Sources,
+		}
+		if options.TopValues > 0 {
+			for _, v := range c.Values {
+				if v != nil {
+					cr.Values = append(cr.Values, summarizeValues(v, options.TopValues))
+				}
+			}
+		}
+		if options.ShowOriginalLines {
+			lineTimes := make(timeSlice, 0, len(c.OriginalLines))
+			for t := range c.OriginalLines {
+				lineTimes = append(lineTimes, t)
+			}
+			sort.Sort(lineTimes)
+			for _, t := range lineTimes {
+				for _, line := range c.OriginalLines[t] {
+					cr.Lines = append(cr.Lines, LineReport{
+						Time: t,
+						Line: line,
+					})
+				}
+			}
+		}
+		br.Clusters = append(br.Clusters, cr)
+	}
+	sort.Slice(br.Clusters, func(i, j int) bool {
+		if br.Clusters[i].Count != br.Clusters[j].Count {
+			return br.Clusters[i].Count > br.Clusters[j].Count
+		}
+		return br.Clusters[i].Reference < br.Clusters[j].Reference
+	})
+	return br
+}
+
+func gapReport(g Gap) GapReport {
+	return GapReport{
+		Interval:        g.Interval.String(),
+		IntervalSeconds: g.Interval.Seconds(),
+		Occurrences:     g.Occurrences,
+		Magnitude:       g.Magnitude,
+		Reference:       g.Reference,
+	}
+}
+
+// WriteJSON writes a report as an indented json document
+func WriteJSON(report *Report, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// WriteNDJSON writes a report as one json record per line, each bucket followed by any gaps
+func WriteNDJSON(report *Report, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetEscapeHTML(false)
+	for i := range report.Buckets {
+		err := encoder.Encode(record{
+			Version:      report.Version,
+			Type:         RecordBucket,
+			BucketReport: &report.Buckets[i],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for i := range report.Gaps {
+		err := encoder.Encode(record{
+			Version:   report.Version,
+			Type:      RecordGap,
+			GapReport: &report.Gaps[i],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NDJSONStreamPrinter returns a StreamBucket callback that writes each bucket as an ndjson record
+func (l *logStat) NDJSONStreamPrinter(out io.Writer, options ReportOptions) func(bucketStart time.Time, bucket *Bucket) error {
+	return func(bucketStart time.Time, bucket *Bucket) error {
+		return WriteNDJSON(&Report{
+			Version: ReportVersion,
+			Buckets: []BucketReport{bucketReport(bucketStart, bucket, options)},
+		}, out)
+	}
+}
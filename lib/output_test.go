@@ -0,0 +1,167 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+// reportResult has a bucket with a cluster of two lines with values, and a cluster of one line
+func reportResult() *Result {
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	rare := &Cluster{
+		Reference:     "disk <full>",
+		OriginalLines: map[time.Time][]string{start: {"disk <full>"}},
+		Count:         1,
+		Levels:        map[string]int{"error": 1},
+		Sources:       map[string]int{"b.log": 1},
+	}
+	common := &Cluster{
+		Reference: "user (number) logged in",
+		OriginalLines: map[time.Time][]string{
+			start.Add(30 * time.Second): {"user 8 logged in"},
+			start:                       {"user 7 logged in"},
+		},
+		Count:   2,
+		Levels:  map[string]int{"info": 2},
+		Sources: map[string]int{"a.log": 2},
+	}
+	common.addValues([]string{"(number)"}, []string{"7"})
+	common.addValues([]string{"(number)"}, []string{"8"})
+	return &Result{Buckets: map[time.Time]*Bucket{
+		start: {
+			Notes:     map[string]string{"start of b.log": "", "start of a.log": ""},
+			LineCount: 3,
+			Levels:    map[string]int{"error": 1, "info": 2},
+			Clusters:  map[string]*Cluster{rare.Reference: rare, common.Reference: common},
+		},
+	}}
+}
+
+func TestWriteJSON(t *testing.T) {
+	l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+	report := l.Report(reportResult(), ReportOptions{ShowOriginalLines: true, TopValues: 1})
+	out := &bytes.Buffer{}
+	err := WriteJSON(report, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{
+  "version": 1,
+  "buckets": [
+    {
+      "start": "2023-10-17T04:00:00Z",
+      "lineCount": 3,
+      "notes": [
+        "start of a.log",
+        "start of b.log"
+      ],
+      "levels": {
+        "error": 1,
+        "info": 2
+      },
+      "clusters": [
+        {
+          "reference": "user (number) logged in",
+          "count": 2,
+          "levels": {
+            "info": 2
+          },
+          "sources": {
+            "a.log": 2
+          },
+          "values": [
+            {
+              "placeholder": "(number)",
+              "distinct": 2,
+              "other": 0,
+              "lines": 2,
+              "top": [
+                {
+                  "value": "7",
+                  "count": 1
+                }
+              ],
+              "numeric": {
+                "min": 7,
+                "p50": 7,
+                "p90": 8,
+                "p99": 8,
+                "max": 8
+              }
+            }
+          ],
+          "lines": [
+            {
+              "time": "2023-10-17T04:00:00Z",
+              "line": "user 7 logged in"
+            },
+            {
+              "time": "2023-10-17T04:00:30Z",
+              "line": "user 8 logged in"
+            }
+          ]
+        },
+        {
+          "reference": "disk <full>",
+          "count": 1,
+          "levels": {
+            "error": 1
+          },
+          "sources": {
+            "b.log": 1
+          },
+          "lines": [
+            {
+              "time": "2023-10-17T04:00:00Z",
+              "line": "disk <full>"
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+	report := l.Report(reportResult(), ReportOptions{MinCount: 2})
+	report.Gaps = []GapReport{{
+		Interval:        "30s",
+		IntervalSeconds: 30,
+		Occurrences:     2,
+		Magnitude:       1,
+		Reference:       "user (number) logged in",
+	}}
+	out := &bytes.Buffer{}
+	err := WriteNDJSON(report, out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"version":1,"type":"bucket","start":"2023-10-17T04:00:00Z","lineCount":3,"notes":["start of a.log","start of b.log"],"levels":{"error":1,"info":2},"clusters":[{"reference":"user (number) logged in","count":2,"levels":{"info":2},"sources":{"a.log":2}}]}
+{"version":1,"type":"gap","interval":"30s","intervalSeconds":30,"occurrences":2,"magnitude":1,"reference":"user (number) logged in"}
+`
+	if out.String() != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, out.String())
+	}
+
+	// every record is a json object with the schema version and its type
+	for _, line := range bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n")) {
+		r := map[string]interface{}{}
+		err := json.Unmarshal(line, &r)
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		if r["version"] != float64(ReportVersion) || (r["type"] != RecordBucket && r["type"] != RecordGap) {
+			t.Errorf("expected a versioned record, got %s", line)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+package lib
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/cjnosal/logstat/pkg/line"
+	"github.com/cjnosal/logstat/pkg/regex"
+)
+
+// MessageField names the message in the Fields of a denoise rule
+const MessageField = "message"
+
+// DenoiseRule replaces matches of Regex with Replacement. A rule applies to the message unless Fields
+// lists the grouping fields (or "message") it applies to, and to every source unless Sources lists
+// globs matching the source path or file name.
+type DenoiseRule struct {
+	Name        string   `yaml:"name"`
+	Regex       string   `yaml:"regex"`
+	Replacement string   `yaml:"replacement"`
+	Enabled     *bool    `yaml:"enabled"`
+	Fields      []string `yaml:"fields"`
+	Sources     []string `yaml:"sources"`
+}
+
+type ruleFile struct {
+	Profiles []string      `yaml:"profiles"`
+	Rules    []DenoiseRule `yaml:"rules"`
+}
+
+var (
+	builtinRules = []DenoiseRule{
+		{Name: "guids", Regex: regex.GUID, Replacement: "(guid)"},
+		{Name: "urls", Regex: regex.URLS, Replacement: "(url)"},
+		{Name: "macs", Regex: regex.MACS, Replacement: "(mac)"},
+		{Name: "ipv6", Regex: regex.IPV6, Replacement: "(ip)"},
+		{Name: "ipv4", Regex: regex.IPV4, Replacement: "(ip)"},
+		{Name: "winpaths", Regex: regex.WINPATHS, Replacement: "(path)"},
+		{Name: "unixpaths", Regex: regex.UNIXPATHS, Replacement: "(path)"},
+		{Name: "k8s", Regex: regex.K8SPODS, Replacement: "-(pod)"},
+		{Name: "k8sreplicasets", Regex: regex.K8SREPLICASETS, Replacement: "-(replicaset)"},
+		{Name: "durations", Regex: regex.DURATIONS, Replacement: "(duration)"},
+		{Name: "base64", Regex: regex.BASE64, Replacement: "(base64)"},
+		{Name: "longhex", Regex: regex.LONGHEX, Replacement: "(hex)"},
+		{Name: "longwords", Regex: regex.LONGWORDS, Replacement: "(longword)"},
+		{Name: "emails", Regex: regex.EMAILS, Replacement: "(email)"},
+	}
+	fallbackRules = []DenoiseRule{
+		{Name: "alphanum", Regex: regex.ALPHANUM, Replacement: "(alphanum)"},
+		{Name: "numbers", Regex: regex.NUMBERS, Replacement: "(number)"},
+	}
+
+	denoiseProfiles = map[string][]DenoiseRule{
+		"nginx": {
+			{Name: "nginx-query", Regex: "\\?[^\\s\"]*", Replacement: "?(query)"},
+			{Name: "nginx-agent", Regex: "\"[^\"]*\" \"[^\"]*\"$", Replacement: "\"(referer)\" \"(agent)\""},
+			{Name: "nginx-host", Regex: "\\b(server: [^,\\s]+|host: \"[^\"]*\")", Replacement: "(host)"},
+		},
+		"java": {
+			{Name: "java-stack", Regex: "(\\n\\s*(at |\\.\\.\\. \\d+ more)[^\\n]*)+", Replacement: "\n\tat (stack)"},
+			{Name: "java-thread", Regex: "\\b(pool-\\d+-thread-\\d+|ForkJoinPool[\\w.-]*-worker-\\d+|[\\w-]+-exec-\\d+)\\b", Replacement: "(thread)"},
+			{Name: "java-object", Regex: "\\b([a-zA-Z_$][\\w$]*\\.)+[A-Z][\\w$]*@[0-9a-f]{4,}\\b", Replacement: "(object)"},
+			{Name: "java-lambda", Regex: "\\$\\$Lambda\\$\\d+/(0x)?[0-9a-f]+", Replacement: "(lambda)"},
+		},
+		"k8s": {
+			{Name: "k8s-digest", Regex: "@sha256:[0-9a-f]{64}\\b", Replacement: ":(digest)"},
+			{Name: "k8s-container", Regex: "\\b(containerd|docker|cri-o)://[0-9a-f]{64}\\b", Replacement: "(container)"},
+			{Name: "k8s-object", Regex: "\"[a-z0-9]([-a-z0-9]*[a-z0-9])?/[a-z0-9]([-a-z0-9.]*[a-z0-9])?\"", Replacement: "\"(namespace)/(name)\""},
+		},
+	}
+)
+
+// DenoiseProfileNames lists the built-in denoise rule profiles
+func DenoiseProfileNames() []string {
+	names := []string{}
+	for name := range denoiseProfiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DenoiseProfile returns the rules of a built-in profile
+func DenoiseProfile(name string) ([]DenoiseRule, bool) {
+	rules, ok := denoiseProfiles[name]
+	return append([]DenoiseRule{}, rules...), ok
+}
+
+// LoadRules reads a yaml list of denoise rules, after the rules of any built-in profiles it names, e.g.
+//
+//	profiles: [java]
+//	rules:
+//	- name: session
+//	  regex: 'session=\w+'
+//	  replacement: session=(session)
+//	  sources: ["app-*.log"]
+//	- name: host
+//	  regex: '\.example\.com$'
+//	  replacement: .(domain)
+//	  fields: [host]
+//	- name: numbers
+//	  enabled: false
+func LoadRules(reader io.Reader) ([]DenoiseRule, error) {
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	file := ruleFile{}
+	err = yaml.UnmarshalStrict(data, &file)
+	if err != nil {
+		return nil, err
+	}
+	rules := []DenoiseRule{}
+	for _, p := range file.Profiles {
+		profile, ok := DenoiseProfile(p)
+		if !ok {
+			return nil, fmt.Errorf("Unknown denoise profile %s (expected one of %v)", p, DenoiseProfileNames())
+		}
+		rules = append(rules, profile...)
+	}
+	for _, rule := range file.Rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("Denoise rule missing name: %+v", rule)
+		}
+		if _, err := regexp.Compile(rule.Regex); err != nil {
+			return nil, fmt.Errorf("Invalid regex for denoise rule %s: %v", rule.Name, err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// DenoiseRules orders denoise rules by precedence: the rule sets (profiles and rule files) in the
+// order given, then the built-in rules, then patterns, then the alphanum and numbers fallbacks.
+// A rule named like a built-in rule or a rule of an earlier set updates that rule in place, so later
+// sets can change or disable earlier rules. New rules without a replacement use noise.
+func DenoiseRules(ruleSets [][]DenoiseRule, patterns []DenoiseRule, noise string) ([]DenoiseRule, error) {
+	custom := []DenoiseRule{}
+	builtin := append([]DenoiseRule{}, builtinRules...)
+	fallback := append([]DenoiseRule{}, fallbackRules...)
+	for _, set := range ruleSets {
+		for _, rule := range set {
+			if overrideRule(custom, rule) || overrideRule(builtin, rule) || overrideRule(fallback, rule) {
+				continue
+			}
+			if rule.Regex == "" {
+				return nil, fmt.Errorf("Denoise rule %s needs a regex", rule.Name)
+			}
+			if rule.Replacement == "" {
+				rule.Replacement = noise
+			}
+			custom = append(custom, rule)
+		}
+	}
+	rules := append(custom, builtin...)
+	rules = append(rules, patterns...)
+	return append(rules, fallback...), nil
+}
+
+// overrideRule updates the rule with the same name, if any, with the fields set by the override
+func overrideRule(rules []DenoiseRule, override DenoiseRule) bool {
+	if override.Name == "" {
+		return false
+	}
+	for i, rule := range rules {
+		if rule.Name != override.Name {
+			continue
+		}
+		if override.Regex != "" {
+			rules[i].Regex = override.Regex
+		}
+		if override.Replacement != "" {
+			rules[i].Replacement = override.Replacement
+		}
+		if override.Enabled != nil {
+			rules[i].Enabled = override.Enabled
+		}
+		if override.Fields != nil {
+			rules[i].Fields = override.Fields
+		}
+		if override.Sources != nil {
+			rules[i].Sources = override.Sources
+		}
+		return true
+	}
+	return false
+}
+
+// applies reports whether the rule denoises the field (or the message when field is empty) of a source
+func (rule *DenoiseRule) applies(source string, field string) bool {
+	if rule.Enabled != nil && !*rule.Enabled {
+		return false
+	}
+	if field == "" {
+		field = MessageField
+	}
+	if len(rule.Fields) == 0 && field != MessageField {
+		return false
+	}
+	if len(rule.Fields) > 0 && !contains(rule.Fields, field) {
+		return false
+	}
+	if len(rule.Sources) == 0 {
+		return true
+	}
+	for _, glob := range rule.Sources {
+		if matchesGlob(glob, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// denoisePatterns returns the datetime patterns and the rules that denoise the field of a source
+func denoisePatterns(config Config, source string, field string) [][]string {
+	patterns := [][]string{}
+	if field == "" {
+		patterns = append(patterns, config.DenoisePatterns...)
+	}
+	for i := range config.DenoiseRules {
+		rule := &config.DenoiseRules[i]
+		if rule.applies(source, field) {
+			patterns = append(patterns, []string{rule.Regex, rule.Replacement})
+		}
+	}
+	return patterns
+}
+
+// newFieldDenoisers returns a denoiser for each grouping field of a source with rules applying to it
+func newFieldDenoisers(config Config, source string) (map[string]line.LineProcessor, error) {
+	denoisers := map[string]line.LineProcessor{}
+	for _, field := range config.GroupFields {
+		patterns := denoisePatterns(config, source, field)
+		if len(patterns) == 0 {
+			continue
+		}
+		lp, err := line.NewLineProcessor(nil, patterns, nil)
+		if err != nil {
+			return nil, err
+		}
+		denoisers[field] = lp
+	}
+	return denoisers, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
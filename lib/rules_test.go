@@ -0,0 +1,175 @@
+package lib
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		rules []string
+		err   string
+	}{
+		{
+			name: "profiles before rules",
+			yaml: `profiles: [k8s]
+rules:
+- name: session
+  regex: 'session=\w+'
+  replacement: session=(session)
+- name: numbers
+  enabled: false
+`,
+			rules: []string{"k8s-digest", "k8s-container", "k8s-object", "session", "numbers"},
+		},
+		{
+			name: "unknown profile",
+			yaml: "profiles: [cobol]\n",
+			err:  "Unknown denoise profile cobol",
+		},
+		{
+			name: "missing name",
+			yaml: "rules:\n- regex: 'a+'\n",
+			err:  "Denoise rule missing name",
+		},
+		{
+			name: "invalid regex",
+			yaml: "rules:\n- name: broken\n  regex: '(a'\n",
+			err:  "Invalid regex for denoise rule broken",
+		},
+		{
+			name: "unknown field",
+			yaml: "rules:\n- name: session\n  regex: 'session=\\w+'\n  replacment: (session)\n",
+			err:  "field replacment not found",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rules, err := LoadRules(strings.NewReader(test.yaml))
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Fatalf("expected error %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, rule := range rules {
+				names = append(names, rule.Name)
+			}
+			if strings.Join(names, ",") != strings.Join(test.rules, ",") {
+				t.Errorf("expected rules %v, got %v", test.rules, names)
+			}
+		})
+	}
+}
+
+func TestDenoiseRulesPrecedence(t *testing.T) {
+	disabled, enabled := false, true
+	profile, _ := DenoiseProfile("java")
+	file, err := LoadRules(strings.NewReader(`rules:
+- name: java-thread
+  enabled: false
+- name: numbers
+  replacement: (n)
+- name: emails
+  replacement: (address)
+- name: session
+  regex: 'session=\w+'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toggles := []DenoiseRule{
+		{Name: "numbers", Enabled: &disabled},
+		{Name: "java-thread", Enabled: &enabled},
+	}
+	patterns := []DenoiseRule{{Regex: "id=\\d+", Replacement: "id=(id)"}}
+
+	rules, err := DenoiseRules([][]DenoiseRule{profile, file, toggles}, patterns, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := map[string]DenoiseRule{}
+	names := []string{}
+	for _, rule := range rules {
+		byName[rule.Name] = rule
+		names = append(names, rule.Name)
+	}
+
+	// profile and file rules first, then the built-ins, the patterns and the fallbacks
+	expected := []string{"java-stack", "java-thread", "java-object", "java-lambda", "session"}
+	for _, rule := range builtinRules {
+		expected = append(expected, rule.Name)
+	}
+	expected = append(expected, "", "alphanum", "numbers")
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected rules in order %v, got %v", expected, names)
+	}
+
+	if rule := byName["session"]; rule.Replacement != "*" {
+		t.Errorf("expected a new rule without a replacement to use the noise replacement, got %q", rule.Replacement)
+	}
+	if rule := byName["emails"]; rule.Replacement != "(address)" || rule.Regex == "" {
+		t.Errorf("expected the file to change the built-in replacement only, got %+v", rule)
+	}
+	// the cli toggles win over the file
+	if rule := byName["numbers"]; rule.Replacement != "(n)" || rule.applies("app.log", "") {
+		t.Errorf("expected numbers to be replaced by (n) but disabled, got %+v", rule)
+	}
+	if rule := byName["java-thread"]; !rule.applies("app.log", "") {
+		t.Errorf("expected java-thread to be enabled again, got %+v", rule)
+	}
+	if rule := byName["guids"]; !rule.applies("app.log", "") {
+		t.Errorf("expected untouched built-in rules to apply, got %+v", rule)
+	}
+
+	// the built-in rules are not changed for later calls
+	rules, err = DenoiseRules(nil, nil, "*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		if rule.Name == "emails" && rule.Replacement != "(email)" {
+			t.Errorf("expected the built-in emails rule to be unchanged, got %+v", rule)
+		}
+	}
+}
+
+func TestDenoiseRulesMissingRegex(t *testing.T) {
+	_, err := DenoiseRules([][]DenoiseRule{{{Name: "session"}}}, nil, "*")
+	if err == nil || !strings.Contains(err.Error(), "Denoise rule session needs a regex") {
+		t.Errorf("expected a missing regex error, got %v", err)
+	}
+}
+
+func TestDenoiseRuleApplies(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name    string
+		rule    DenoiseRule
+		source  string
+		field   string
+		applies bool
+	}{
+		{"message", DenoiseRule{}, "/var/log/app.log", "", true},
+		{"not other fields", DenoiseRule{}, "/var/log/app.log", "host", false},
+		{"disabled", DenoiseRule{Enabled: &disabled}, "/var/log/app.log", "", false},
+		{"listed field", DenoiseRule{Fields: []string{"host"}}, "/var/log/app.log", "host", true},
+		{"not the message unless listed", DenoiseRule{Fields: []string{"host"}}, "/var/log/app.log", "", false},
+		{"listed message", DenoiseRule{Fields: []string{"host", MessageField}}, "/var/log/app.log", "", true},
+		{"source file name", DenoiseRule{Sources: []string{"app-*.log"}}, "/var/log/app-1.log", "", true},
+		{"source path", DenoiseRule{Sources: []string{"/var/log/*.log"}}, "/var/log/db.log", "", true},
+		{"other source", DenoiseRule{Sources: []string{"app-*.log"}}, "/var/log/db.log", "", false},
+		{"field of a source", DenoiseRule{Fields: []string{"host"}, Sources: []string{"app-*.log"}}, "/var/log/db.log", "host", false},
+	}
+	for _, test := range tests {
+		if test.rule.applies(test.source, test.field) != test.applies {
+			t.Errorf("%s: expected applies to be %t", test.name, test.applies)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package lib
+
+import (
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"time"
+)
+
+const (
+	skewResolution      = time.Second
+	defaultMaxClockSkew = 5 * time.Minute
+)
+
+// estimateClockOffsets returns the offset to add to the times of each file to align its clock with
+// the first file, using the median difference between anchor events when anchors are configured and
+// otherwise the lag that maximizes the cross-correlation of per-second line counts
+func (l *logStat) estimateClockOffsets(logFiles []string, config Config) (map[string]time.Duration, error) {
+	scanner := &logStat{
+		logger: log.New(ioutil.Discard, "", 0),
+	}
+	var err error
+	scan := config
+	scan.BucketDuration = skewResolution
+	scan.StartTime = nil
+	scan.EndTime = nil
+	scan.RelativeStartTime = nil
+	scan.RelativeEndTime = nil
+	scan.DisplayLocation = nil
+	anchors := make([]*regexp.Regexp, len(config.ClockSkewAnchors))
+	if len(anchors) > 0 {
+		for i, a := range config.ClockSkewAnchors {
+			anchors[i], err = regexp.Compile(a)
+			if err != nil {
+				return nil, err
+			}
+		}
+		scan.LineFilters = config.ClockSkewAnchors
+		scan.KeepOriginalLines = true
+	}
+
+	results := make([]*Result, len(logFiles))
+	for i, lf := range logFiles {
+		results[i] = &Result{
+			Buckets: map[time.Time]*Bucket{},
+		}
+		if i > 0 {
+			results[i].ReferenceTime = results[0].ReferenceTime
+		}
+		err = scanner.processFile(lf, scan, results[i], 0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	maxSkew := config.MaxClockSkew
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxClockSkew
+	}
+	offsets := map[string]time.Duration{}
+	for i, lf := range logFiles[1:] {
+		if len(anchors) > 0 {
+			offset, matched := anchorOffset(anchors, results[0], results[i+1])
+			if matched == 0 {
+				l.logger.Printf("%s: no clock skew anchors in common with %s\n", lf, logFiles[0])
+				continue
+			}
+			offsets[lf] = offset
+			l.logger.Printf("%s: clock offset %s relative to %s from %d anchors\n", lf, offset, logFiles[0], matched)
+		} else {
+			offset, ok := correlationOffset(results[0], results[i+1], maxSkew)
+			if !ok {
+				l.logger.Printf("%s: no overlap with %s to estimate clock skew\n", lf, logFiles[0])
+				continue
+			}
+			offsets[lf] = offset
+			l.logger.Printf("%s: clock offset %s relative to %s from line count cross-correlation\n", lf, offset, logFiles[0])
+		}
+	}
+	return offsets, nil
+}
+
+// firstAnchorTimes finds the earliest time each anchor pattern matched
+func firstAnchorTimes(anchors []*regexp.Regexp, result *Result) map[int]time.Time {
+	first := map[int]time.Time{}
+	for _, bucket := range result.Buckets {
+		for _, cluster := range bucket.Clusters {
+			for t, lines := range cluster.OriginalLines {
+				for _, line := range lines {
+					for i, a := range anchors {
+						if prev, ok := first[i]; a.MatchString(line) && (!ok || t.Before(prev)) {
+							first[i] = t
+						}
+					}
+				}
+			}
+		}
+	}
+	return first
+}
+
+func anchorOffset(anchors []*regexp.Regexp, reference *Result, other *Result) (time.Duration, int) {
+	referenceTimes := firstAnchorTimes(anchors, reference)
+	otherTimes := firstAnchorTimes(anchors, other)
+	diffs := durationSlice{}
+	for i, rt := range referenceTimes {
+		if ot, ok := otherTimes[i]; ok {
+			diffs = append(diffs, rt.Sub(ot))
+		}
+	}
+	if len(diffs) == 0 {
+		return 0, 0
+	}
+	sort.Sort(diffs)
+	median := diffs[len(diffs)/2]
+	if len(diffs)%2 == 0 {
+		median = (diffs[len(diffs)/2-1] + median) / 2
+	}
+	return median, len(diffs)
+}
+
+func correlationOffset(reference *Result, other *Result, maxSkew time.Duration) (time.Duration, bool) {
+	var best time.Duration
+	bestScore := 0
+	maxLag := int64(maxSkew / skewResolution)
+	for lag := int64(0); lag <= maxLag; lag++ {
+		for _, sign := range []int64{1, -1} {
+			if lag == 0 && sign < 0 {
+				continue
+			}
+			offset := time.Duration(sign*lag) * skewResolution
+			score := 0
+			for t, bucket := range other.Buckets {
+				if t.Year() <= epoch.Year() {
+					// lines without datetimes
+					continue
+				}
+				if match, ok := reference.Buckets[t.Add(offset)]; ok {
+					score += bucket.LineCount * match.LineCount
+				}
+			}
+			if score > bestScore {
+				best = offset
+				bestScore = score
+			}
+		}
+	}
+	return best, bestScore > 0
+}
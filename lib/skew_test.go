@@ -0,0 +1,74 @@
+package lib
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeSkewedLog writes up to 4 lines a second over five minutes, with deploy events at 100s and 250s,
+// as seen by a clock that is behind by skew
+func writeSkewedLog(t *testing.T, path string, skew time.Duration) {
+	b := &strings.Builder{}
+	r := rand.New(rand.NewSource(1))
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	for sec := 0; sec < 300; sec++ {
+		ts := start.Add(time.Duration(sec)*time.Second - skew).Format(time.RFC3339)
+		for i := r.Intn(5); i > 0; i-- {
+			fmt.Fprintf(b, "%s request %d handled\n", ts, i)
+		}
+		switch sec {
+		case 100:
+			fmt.Fprintf(b, "%s deploy started\n", ts)
+		case 250:
+			fmt.Fprintf(b, "%s deploy finished\n", ts)
+		}
+	}
+	err := ioutil.WriteFile(path, []byte(b.String()), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEstimateClockOffsets(t *testing.T) {
+	dir := t.TempDir()
+	reference := filepath.Join(dir, "reference.log")
+	behind := filepath.Join(dir, "behind.log")
+	ahead := filepath.Join(dir, "ahead.log")
+	writeSkewedLog(t, reference, 0)
+	writeSkewedLog(t, behind, 42*time.Second)
+	writeSkewedLog(t, ahead, -7*time.Second)
+
+	tests := []struct {
+		name   string
+		config func(c *Config)
+	}{
+		{"anchors", func(c *Config) { c.ClockSkewAnchors = []string{"deploy started", "deploy finished"} }},
+		{"cross-correlation", func(c *Config) { c.EstimateClockSkew = true }},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig()
+			test.config(&config)
+			l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+			offsets, err := l.estimateClockOffsets([]string{reference, behind, ahead}, config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := map[string]time.Duration{
+				behind: 42 * time.Second,
+				ahead:  -7 * time.Second,
+			}
+			for file, offset := range expected {
+				if offsets[file] != offset {
+					t.Errorf("%s: expected offset %s, got %s", filepath.Base(file), offset, offsets[file])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"time"
+)
+
+// spillFile holds original lines of open buckets on disk until the bucket is emitted
+type spillFile struct {
+	file     *os.File
+	size     int64
+	segments map[time.Time][]spillSegment
+	// locations of spilled line times, so restored times are the same map keys as before (gob
+	// decodes times with a fixed zone)
+	locations map[string]*time.Location
+}
+
+type spillSegment struct {
+	offset int64
+	length int
+}
+
+type spilledLines struct {
+	Reference string
+	UnixNano  int64
+	Location  string
+	Lines     []string
+}
+
+func newSpillFile() (*spillFile, error) {
+	f, err := os.CreateTemp("", "logstat-spill-")
+	if err != nil {
+		return nil, err
+	}
+	return &spillFile{
+		file:      f,
+		segments:  map[time.Time][]spillSegment{},
+		locations: map[string]*time.Location{},
+	}, nil
+}
+
+// write moves the original lines of a bucket to disk, keeping its clusters and counts in memory
+func (s *spillFile) write(bucketStart time.Time, bucket *Bucket) error {
+	spilled := []spilledLines{}
+	for ref, c := range bucket.Clusters {
+		for t, lines := range c.OriginalLines {
+			location := locationKey(t)
+			if _, ok := s.locations[location]; !ok {
+				s.locations[location] = t.Location()
+			}
+			spilled = append(spilled, spilledLines{
+				Reference: ref,
+				UnixNano:  t.UnixNano(),
+				Location:  location,
+				Lines:     lines,
+			})
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(spilled)
+	if err != nil {
+		return err
+	}
+	n, err := s.file.WriteAt(buf.Bytes(), s.size)
+	if err != nil {
+		return err
+	}
+	s.segments[bucketStart] = append(s.segments[bucketStart], spillSegment{
+		offset: s.size,
+		length: n,
+	})
+	s.size += int64(n)
+	for _, c := range bucket.Clusters {
+		c.OriginalLines = map[time.Time][]string{}
+	}
+	return nil
+}
+
+// restore reads the spilled lines of a bucket back, ahead of any lines kept since
+func (s *spillFile) restore(bucketStart time.Time, bucket *Bucket) error {
+	if s == nil {
+		return nil
+	}
+	restored := map[*Cluster]map[time.Time][]string{}
+	for _, segment := range s.segments[bucketStart] {
+		data := make([]byte, segment.length)
+		_, err := s.file.ReadAt(data, segment.offset)
+		if err != nil {
+			return err
+		}
+		spilled := []spilledLines{}
+		err = gob.NewDecoder(bytes.NewReader(data)).Decode(&spilled)
+		if err != nil {
+			return err
+		}
+		for _, sl := range spilled {
+			c := bucket.Clusters[sl.Reference]
+			if restored[c] == nil {
+				restored[c] = map[time.Time][]string{}
+			}
+			t := time.Unix(0, sl.UnixNano).In(s.locations[sl.Location])
+			restored[c][t] = append(restored[c][t], sl.Lines...)
+		}
+	}
+	// segments were written in order, and before the lines still in memory
+	for c, times := range restored {
+		for t, lines := range times {
+			c.OriginalLines[t] = append(lines, c.OriginalLines[t]...)
+		}
+	}
+	delete(s.segments, bucketStart)
+	return nil
+}
+
+// locationKey names the location of a time, including its offset since fixed zones may be unnamed
+func locationKey(t time.Time) string {
+	_, offset := t.Zone()
+	return fmt.Sprintf("%s %d", t.Location(), offset)
+}
+
+func (s *spillFile) discard(bucketStart time.Time) {
+	if s != nil {
+		delete(s.segments, bucketStart)
+	}
+}
+
+func (s *spillFile) close() {
+	if s == nil {
+		return
+	}
+	s.file.Close()
+	os.Remove(s.file.Name())
+}
@@ -0,0 +1,288 @@
+package lib
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+)
+
+type streamInput struct {
+	src     *source
+	bufr    *bufio.Reader
+	closers []io.Closer
+}
+
+func (in *streamInput) close() {
+	for _, c := range in.closers {
+		c.Close()
+	}
+	in.closers = nil
+}
+
+type streamer struct {
+	logger  *log.Logger
+	config  Config
+	result  *Result
+	emitted *time.Time
+	nextDue *time.Time
+	open    int
+	memory  int64
+	spill   *spillFile
+	counts  map[time.Time]*Bucket
+	late    int
+}
+
+func (l *logStat) streamFiles(logFiles []string, config Config, result *Result) error {
+	inputs := []*streamInput{}
+	defer func() {
+		for _, in := range inputs {
+			in.close()
+		}
+	}()
+	for _, lf := range logFiles {
+		in, err := openInput(lf, config, result.ClockOffsets[lf])
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, in)
+	}
+	return l.stream(inputs, config, result)
+}
+
+// stream interleaves the inputs by time, always reading from the input that is furthest behind,
+// and emits each bucket once every input has moved ReorderWindow past its end
+func (l *logStat) stream(inputs []*streamInput, config Config, result *Result) error {
+	if config.RelativeStartTime != nil || config.RelativeEndTime != nil {
+		return fmt.Errorf("Start and end times relative to the input are not supported when streaming")
+	}
+	if config.FuzzyMerge > 0 {
+		return fmt.Errorf("Fuzzy cluster merging is not supported when streaming")
+	}
+	st := &streamer{
+		logger: l.logger,
+		config: config,
+		result: result,
+		counts: map[time.Time]*Bucket{},
+	}
+	defer func() {
+		st.spill.close()
+	}()
+
+	active := append([]*streamInput{}, inputs...)
+	for len(active) > 0 {
+		next := 0
+		for i, in := range active {
+			if earlier(in.src.prevLineTime, active[next].src.prevLineTime) {
+				next = i
+			}
+		}
+		in := active[next]
+		str, err := in.bufr.ReadString('\n')
+		if err == nil {
+			l.processSourceLine(in.src, str, config, result)
+		} else if err == io.EOF {
+			l.finishSource(in.src, config, result)
+			in.close()
+			active = append(active[:next], active[next+1:]...)
+		} else {
+			return err
+		}
+		st.memory += in.src.kept
+		in.src.kept = 0
+
+		if watermark := streamWatermark(active); watermark != nil {
+			err = st.advance(*watermark)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return st.finish()
+}
+
+// earlier orders inputs that have not found a datetime yet first
+func earlier(a *time.Time, b *time.Time) bool {
+	if a == nil {
+		return b != nil
+	}
+	return b != nil && a.Before(*b)
+}
+
+// streamWatermark is the time every active input has reached
+func streamWatermark(active []*streamInput) *time.Time {
+	var watermark *time.Time
+	for _, in := range active {
+		if in.src.prevLineTime == nil {
+			return nil
+		}
+		if watermark == nil || in.src.prevLineTime.Before(*watermark) {
+			watermark = in.src.prevLineTime
+		}
+	}
+	return watermark
+}
+
+// advance emits the buckets that ended more than ReorderWindow before the watermark, and
+// spills original lines to disk once they exceed MemoryBudget
+func (st *streamer) advance(watermark time.Time) error {
+	if st.config.MemoryBudget > 0 && st.memory > st.config.MemoryBudget {
+		err := st.spillOpenBuckets()
+		if err != nil {
+			return err
+		}
+	}
+	if st.nextDue != nil && watermark.Before(*st.nextDue) && len(st.result.Buckets) == st.open {
+		return nil
+	}
+	complete := timeSlice{}
+	st.nextDue = nil
+	for bucketStart := range st.result.Buckets {
+		due := bucketStart.Add(st.config.BucketDuration + st.config.ReorderWindow)
+		if !watermark.Before(due) {
+			complete = append(complete, bucketStart)
+		} else if st.nextDue == nil || due.Before(*st.nextDue) {
+			st.nextDue = &due
+		}
+	}
+	sort.Sort(complete)
+	for _, bucketStart := range complete {
+		err := st.emit(bucketStart)
+		if err != nil {
+			return err
+		}
+	}
+	st.open = len(st.result.Buckets)
+	return nil
+}
+
+func (st *streamer) emit(bucketStart time.Time) error {
+	bucket := st.result.Buckets[bucketStart]
+	delete(st.result.Buckets, bucketStart)
+	st.memory -= st.keptBytes(bucket)
+	if st.emitted != nil && !bucketStart.After(*st.emitted) {
+		// the bucket was already emitted before these lines arrived
+		st.late += bucket.LineCount
+		st.spill.discard(bucketStart)
+		return nil
+	}
+	err := st.spill.restore(bucketStart, bucket)
+	if err != nil {
+		return err
+	}
+	emitted := bucket
+	if st.result.templates != nil {
+		emitted = templateBucket(bucket)
+	}
+	err = st.config.StreamBucket(bucketStart, emitted)
+	if err != nil {
+		return err
+	}
+	st.emitted = &bucketStart
+	if st.config.KeepStreamedCounts {
+		st.counts[bucketStart] = countsOnly(bucket)
+	}
+	return nil
+}
+
+func (st *streamer) finish() error {
+	remaining := timeSlice{}
+	for bucketStart := range st.result.Buckets {
+		remaining = append(remaining, bucketStart)
+	}
+	sort.Sort(remaining)
+	for _, bucketStart := range remaining {
+		err := st.emit(bucketStart)
+		if err != nil {
+			return err
+		}
+	}
+	if st.late > 0 {
+		st.logger.Printf("Dropped %d lines that arrived more than %s out of order\n", st.late, st.config.ReorderWindow)
+	}
+	st.result.Buckets = st.counts
+	applyTemplates(st.result)
+	return nil
+}
+
+func (st *streamer) spillOpenBuckets() error {
+	if st.spill == nil {
+		spill, err := newSpillFile()
+		if err != nil {
+			return err
+		}
+		st.spill = spill
+	}
+	for bucketStart, bucket := range st.result.Buckets {
+		kept := st.keptBytes(bucket)
+		if kept == 0 {
+			continue
+		}
+		err := st.spill.write(bucketStart, bucket)
+		if err != nil {
+			return err
+		}
+		st.memory -= kept
+	}
+	return nil
+}
+
+func (st *streamer) keptBytes(bucket *Bucket) int64 {
+	if !st.config.KeepOriginalLines {
+		return 0
+	}
+	var kept int64
+	for _, c := range bucket.Clusters {
+		for _, lines := range c.OriginalLines {
+			for _, line := range lines {
+				kept += int64(len(line))
+			}
+		}
+	}
+	return kept
+}
+
+// countsOnly keeps the cluster counts of a bucket without its original lines
+func countsOnly(bucket *Bucket) *Bucket {
+	counts := &Bucket{
+		Notes:     bucket.Notes,
+		Clusters:  map[string]*Cluster{},
+		LineCount: bucket.LineCount,
+		Levels:    bucket.Levels,
+	}
+	for ref, c := range bucket.Clusters {
+		counts.Clusters[ref] = &Cluster{
+			Reference: c.Reference,
+			Count:     c.Count,
+			Levels:    c.Levels,
+			Sources:   c.Sources,
+			template:  c.template,
+		}
+	}
+	return counts
+}
+
+// StreamPrinter returns a StreamBucket callback that prints a histogram row for each bucket, scaled
+// to the largest bucket so far, followed by its clusters when showBuckets is set
+func (l *logStat) StreamPrinter(out io.Writer, showBuckets bool, showOriginalLines bool, minCount int, topValues int, histogram HistogramOptions) func(bucketStart time.Time, bucket *Bucket) error {
+	outLog := log.New(out, "", 0)
+	labeler := &histogramLabeler{short: histogram.ShortLabels}
+	barWidth := 0
+	maxCount := 0
+	return func(bucketStart time.Time, bucket *Bucket) error {
+		if bucket.LineCount > maxCount {
+			maxCount = bucket.LineCount
+		}
+		label := labeler.label(bucketStart)
+		if barWidth == 0 {
+			barWidth = histogram.barWidth(len([]rune(label)) + streamCountsWidth)
+		}
+		writeHistogramRow(out, label, bucket, barEighths(bucket.LineCount, maxCount, barWidth, histogram.LogScale), histogram)
+		if showBuckets {
+			writeBucket(outLog, "", bucket, showOriginalLines, minCount, topValues)
+		}
+		return nil
+	}
+}
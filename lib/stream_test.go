@@ -0,0 +1,156 @@
+package lib
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+type streamedBucket struct {
+	start time.Time
+	lines []string
+}
+
+// streamLines streams input and returns the original lines of each emitted bucket in time order
+func streamLines(t *testing.T, input string, config Config, logs *bytes.Buffer) []streamedBucket {
+	emitted := []streamedBucket{}
+	config.StreamBucket = func(bucketStart time.Time, bucket *Bucket) error {
+		lines := []string{}
+		for _, c := range bucket.Clusters {
+			for _, original := range c.OriginalLines {
+				lines = append(lines, original...)
+			}
+		}
+		emitted = append(emitted, streamedBucket{bucketStart, lines})
+		return nil
+	}
+	lsl := NewLogStat(log.New(logs, "", 0))
+	_, err := lsl.ProcessStream(strings.NewReader(input), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return emitted
+}
+
+func TestStreamReorderWindow(t *testing.T) {
+	config := testConfig()
+	config.ReorderWindow = 30 * time.Second
+	input := strings.Join([]string{
+		"2023-10-17T04:00:00Z a",
+		"2023-10-17T04:01:05Z b",
+		// within the reorder window of its bucket
+		"2023-10-17T04:00:50Z c",
+		// moves the watermark past 04:01:30, emitting the 04:00 bucket
+		"2023-10-17T04:01:40Z d",
+		// too late for the 04:00 bucket
+		"2023-10-17T04:00:55Z e",
+		"2023-10-17T04:02:10Z f",
+	}, "\n") + "\n"
+	logs := &bytes.Buffer{}
+	emitted := streamLines(t, input, config, logs)
+
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	expected := []int{2, 2, 1}
+	if len(emitted) != len(expected) {
+		t.Fatalf("expected %d buckets, got %+v", len(expected), emitted)
+	}
+	for i, b := range emitted {
+		if !b.start.Equal(start.Add(time.Duration(i) * time.Minute)) {
+			t.Errorf("expected bucket %d to start at %s, got %s", i, start.Add(time.Duration(i)*time.Minute), b.start)
+		}
+		if len(b.lines) != expected[i] {
+			t.Errorf("expected %d lines in bucket %d, got %q", expected[i], i, b.lines)
+		}
+		for _, line := range b.lines {
+			if strings.HasSuffix(line, " e") {
+				t.Errorf("expected the late line to be dropped, got it in bucket %d", i)
+			}
+		}
+	}
+	if !strings.Contains(logs.String(), "Dropped 1 lines that arrived more than 30s out of order") {
+		t.Errorf("expected the late line to be reported, got %q", logs.String())
+	}
+}
+
+func TestStreamSpillRestoresLines(t *testing.T) {
+	for _, location := range []*time.Location{time.UTC, time.FixedZone("EDT", -4*3600)} {
+		t.Run(location.String(), func(t *testing.T) {
+			config := testConfig()
+			config.Location = location
+			// the first two lines exceed the budget and are spilled together, the third once the
+			// fourth arrives
+			config.MemoryBudget = 40
+			input := strings.Join([]string{
+				"2023-10-17T04:00:10 request handled 1",
+				"2023-10-17T04:00:10 request handled 2",
+				"2023-10-17T04:00:10 request handled 3",
+				"2023-10-17T04:05:00 request handled 4",
+			}, "\n") + "\n"
+			var bucket *Bucket
+			config.StreamBucket = func(bucketStart time.Time, b *Bucket) error {
+				if bucket == nil {
+					bucket = b
+				}
+				return nil
+			}
+			lsl := NewLogStat(log.New(&bytes.Buffer{}, "", 0))
+			_, err := lsl.ProcessStream(strings.NewReader(input), config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bucket == nil || len(bucket.Clusters) != 1 {
+				t.Fatalf("expected one cluster, got %+v", bucket)
+			}
+			for _, c := range bucket.Clusters {
+				if len(c.OriginalLines) != 1 {
+					t.Fatalf("expected the lines of one instant under one time, got %v", c.OriginalLines)
+				}
+				for lineTime, lines := range c.OriginalLines {
+					if lineTime.Location() != location {
+						t.Errorf("expected times in %s, got %s", location, lineTime.Location())
+					}
+					expected := strings.Split(input, "\n")[:3]
+					if strings.Join(lines, "|") != strings.Join(expected, "|") {
+						t.Errorf("expected the lines in the order they were read, got %q", lines)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSpillFileRoundTrip(t *testing.T) {
+	spill, err := newSpillFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spill.close()
+	location := time.FixedZone("EDT", -4*3600)
+	bucketStart := time.Date(2023, time.October, 17, 4, 0, 0, 0, location)
+	lineTime := bucketStart.Add(10 * time.Second)
+	bucket := &Bucket{Clusters: map[string]*Cluster{
+		"a": {OriginalLines: map[time.Time][]string{lineTime: {"one", "two"}}},
+	}}
+	err = spill.write(bucketStart, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bucket.Clusters["a"].OriginalLines) != 0 {
+		t.Fatalf("expected the lines to be moved to disk, got %v", bucket.Clusters["a"].OriginalLines)
+	}
+	bucket.Clusters["a"].OriginalLines[lineTime] = []string{"three"}
+
+	err = spill.restore(bucketStart, bucket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bucket.Clusters["a"].OriginalLines
+	if len(lines) != 1 || strings.Join(lines[lineTime], ",") != "one,two,three" {
+		t.Errorf("expected one,two,three at %s, got %v", lineTime, lines)
+	}
+	if len(spill.segments) != 0 {
+		t.Errorf("expected restored segments to be forgotten, got %v", spill.segments)
+	}
+}
@@ -0,0 +1,301 @@
+package lib
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	defaultChartWidth  = 960
+	defaultChartHeight = 360
+	// longest cluster reference shown in a chart legend
+	maxLegendLength = 100
+)
+
+// chart series colors, with otherColor for lines outside the top clusters
+var (
+	chartColors = []string{"#4e79a7", "#f28e2b", "#e15759", "#76b7b2", "#59a14f", "#edc948", "#b07aa1", "#ff9da7", "#9c755f", "#bab0ac"}
+	otherColor  = "#cccccc"
+)
+
+// ChartOptions select what an svg chart draws. With TopClusters > 0 each bucket is stacked by its
+// TopClusters most common clusters (by total lines) and the remaining lines.
+type ChartOptions struct {
+	Title       string
+	TopClusters int
+	// width of each bucket, used to leave room for buckets without lines (default the smallest
+	// interval between buckets)
+	BucketDuration time.Duration
+	// size of the chart in pixels (default 960x360, plus the legend)
+	Width  int
+	Height int
+}
+
+type chartSeries struct {
+	name   string
+	color  string
+	counts []int
+}
+
+// Chart writes an svg bar chart of the lines in each bucket, labeled with bucket times, marking
+// the buckets with notes (the start of each file) and with a legend of the series
+func (l *logStat) Chart(result *Result, out io.Writer, options ChartOptions) error {
+	width := options.Width
+	if width <= 0 {
+		width = defaultChartWidth
+	}
+	height := options.Height
+	if height <= 0 {
+		height = defaultChartHeight
+	}
+
+	bucketTimes := make(timeSlice, 0, len(result.Buckets))
+	for k := range result.Buckets {
+		bucketTimes = append(bucketTimes, k)
+	}
+	sort.Sort(bucketTimes)
+	series := chartSeriesOf(result, bucketTimes, options.TopClusters)
+	slots, slotCount := chartSlots(bucketTimes, options.BucketDuration)
+
+	left, right, top, bottom := 60, 20, 30, 40
+	legendTop := height
+	height += 10 + 18*len(series)
+	plotWidth := float64(width - left - right)
+	plotHeight := float64(legendTop - top - bottom)
+
+	maxCount := 0
+	for _, startTime := range bucketTimes {
+		if result.Buckets[startTime].LineCount > maxCount {
+			maxCount = result.Buckets[startTime].LineCount
+		}
+	}
+	yMax, yStep := niceScale(maxCount)
+
+	svg := &strings.Builder{}
+	fmt.Fprintf(svg, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"Helvetica, Arial, sans-serif\" font-size=\"11\">\n", width, height, width, height)
+	fmt.Fprintf(svg, "<rect width=\"%d\" height=\"%d\" fill=\"#ffffff\"/>\n", width, height)
+	if options.Title != "" {
+		fmt.Fprintf(svg, "<text x=\"%d\" y=\"18\" font-size=\"14\">%s</text>\n", left, svgEscape(options.Title))
+	}
+
+	// y axis
+	for v := 0; v <= yMax; v += yStep {
+		y := float64(top) + plotHeight*(1-float64(v)/float64(yMax))
+		fmt.Fprintf(svg, "<line x1=\"%d\" x2=\"%d\" y1=\"%.1f\" y2=\"%.1f\" stroke=\"#e8e8e8\"/>\n", left, width-right, y, y)
+		fmt.Fprintf(svg, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%d</text>\n", left-6, y+4, v)
+	}
+	fmt.Fprintf(svg, "<text transform=\"translate(14 %.1f) rotate(-90)\" text-anchor=\"middle\">lines</text>\n", float64(top)+plotHeight/2)
+
+	step := plotWidth / float64(slotCount)
+	barWidth := math.Max(1, step-1)
+	if step <= 4 {
+		barWidth = math.Max(1, step)
+	}
+
+	// x axis labels, leaving at least 120 pixels between them
+	layout := chartTimeLayout(bucketTimes, options.BucketDuration)
+	lastLabel := math.Inf(-1)
+	for i, startTime := range bucketTimes {
+		x := float64(left) + float64(slots[i])*step
+		if x-lastLabel < 120 {
+			continue
+		}
+		lastLabel = x
+		fmt.Fprintf(svg, "<line x1=\"%.1f\" x2=\"%.1f\" y1=\"%.1f\" y2=\"%.1f\" stroke=\"#888888\"/>\n", x, x, float64(top)+plotHeight, float64(top)+plotHeight+4)
+		fmt.Fprintf(svg, "<text x=\"%.1f\" y=\"%.1f\">%s</text>\n", x, float64(top)+plotHeight+16, svgEscape(startTime.Format(layout)))
+	}
+	if len(bucketTimes) > 0 && layout != time.RFC3339 {
+		// the date left out of the labels
+		fmt.Fprintf(svg, "<text x=\"%d\" y=\"%.1f\" fill=\"#666666\">%s</text>\n", left, float64(top)+plotHeight+32, svgEscape(bucketTimes[0].Format("2006-01-02 MST")))
+	}
+
+	// bars, stacked from the first series up
+	for i, startTime := range bucketTimes {
+		bucket := result.Buckets[startTime]
+		x := float64(left) + float64(slots[i])*step
+		y := float64(top) + plotHeight
+		fmt.Fprintf(svg, "<g><title>%s: %d lines</title>\n", svgEscape(startTime.Format(time.RFC3339)), bucket.LineCount)
+		for _, s := range series {
+			if s.counts[i] == 0 {
+				continue
+			}
+			h := plotHeight * float64(s.counts[i]) / float64(yMax)
+			y -= h
+			fmt.Fprintf(svg, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"/>\n", x, y, barWidth, h, s.color)
+		}
+		fmt.Fprintf(svg, "</g>\n")
+	}
+	fmt.Fprintf(svg, "<line x1=\"%d\" x2=\"%d\" y1=\"%.1f\" y2=\"%.1f\" stroke=\"#888888\"/>\n", left, width-right, float64(top)+plotHeight, float64(top)+plotHeight)
+
+	// note markers, staggered so the notes of nearby buckets don't overlap
+	marker := 0
+	for i, startTime := range bucketTimes {
+		notes := []string{}
+		for note := range result.Buckets[startTime].Notes {
+			notes = append(notes, note)
+		}
+		sort.Strings(notes)
+		x := float64(left) + float64(slots[i])*step
+		for _, note := range notes {
+			fmt.Fprintf(svg, "<line x1=\"%.1f\" x2=\"%.1f\" y1=\"%d\" y2=\"%.1f\" stroke=\"#333333\" stroke-dasharray=\"4,3\"/>\n", x, x, top, float64(top)+plotHeight)
+			fmt.Fprintf(svg, "<text x=\"%.1f\" y=\"%d\" fill=\"#333333\">%s</text>\n", x+3, top+10+12*(marker%3), svgEscape(note))
+			marker++
+		}
+	}
+
+	// legend
+	for i, s := range series {
+		y := legendTop + 10 + 18*i
+		fmt.Fprintf(svg, "<rect x=\"%d\" y=\"%d\" width=\"10\" height=\"10\" fill=\"%s\"/>\n", left, y, s.color)
+		fmt.Fprintf(svg, "<text x=\"%d\" y=\"%d\">%s</text>\n", left+16, y+9, svgEscape(legendLabel(s.name)))
+	}
+	fmt.Fprintf(svg, "</svg>\n")
+
+	_, err := io.WriteString(out, svg.String())
+	return err
+}
+
+// chartSeriesOf splits the lines of each bucket into the top clusters by total lines and the rest
+func chartSeriesOf(result *Result, bucketTimes []time.Time, topClusters int) []chartSeries {
+	if topClusters <= 0 {
+		total := chartSeries{name: "lines", color: chartColors[0], counts: make([]int, len(bucketTimes))}
+		for i, startTime := range bucketTimes {
+			total.counts[i] = result.Buckets[startTime].LineCount
+		}
+		return []chartSeries{total}
+	}
+
+	totals := map[string]int{}
+	for _, bucket := range result.Buckets {
+		for ref, c := range bucket.Clusters {
+			totals[ref] += c.Count
+		}
+	}
+	refs := []string{}
+	for ref := range totals {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if totals[refs[i]] != totals[refs[j]] {
+			return totals[refs[i]] > totals[refs[j]]
+		}
+		return refs[i] < refs[j]
+	})
+	if len(refs) > topClusters {
+		refs = refs[:topClusters]
+	}
+
+	series := []chartSeries{}
+	other := chartSeries{name: "other", color: otherColor, counts: make([]int, len(bucketTimes))}
+	for i, ref := range refs {
+		s := chartSeries{name: ref, color: chartColors[i%len(chartColors)], counts: make([]int, len(bucketTimes))}
+		for j, startTime := range bucketTimes {
+			if c, ok := result.Buckets[startTime].Clusters[ref]; ok {
+				s.counts[j] = c.Count
+			}
+		}
+		series = append(series, s)
+	}
+	hasOther := false
+	for j, startTime := range bucketTimes {
+		other.counts[j] = result.Buckets[startTime].LineCount
+		for _, s := range series {
+			other.counts[j] -= s.counts[j]
+		}
+		if other.counts[j] < 0 {
+			other.counts[j] = 0
+		}
+		hasOther = hasOther || other.counts[j] > 0
+	}
+	if hasOther {
+		series = append(series, other)
+	}
+	return series
+}
+
+// chartSlots places each bucket in a slot of the bucket duration (or the smallest interval between
+// buckets), so buckets without lines show as gaps
+func chartSlots(bucketTimes []time.Time, bucketDuration time.Duration) ([]int, int) {
+	slots := make([]int, len(bucketTimes))
+	if len(bucketTimes) == 0 {
+		return slots, 1
+	}
+	length := bucketDuration
+	if length <= 0 {
+		for i := 1; i < len(bucketTimes); i++ {
+			interval := bucketTimes[i].Sub(bucketTimes[i-1])
+			if length <= 0 || interval < length {
+				length = interval
+			}
+		}
+	}
+	span := bucketTimes[len(bucketTimes)-1].Sub(bucketTimes[0])
+	if length <= 0 || span/length > 10000 {
+		// too many slots to draw, place buckets side by side instead
+		for i := range slots {
+			slots[i] = i
+		}
+		return slots, len(slots)
+	}
+	for i, t := range bucketTimes {
+		slots[i] = int(t.Sub(bucketTimes[0]) / length)
+	}
+	return slots, slots[len(slots)-1] + 1
+}
+
+// chartTimeLayout leaves the date out of bucket labels when all buckets are on the same day
+func chartTimeLayout(bucketTimes []time.Time, bucketDuration time.Duration) string {
+	if len(bucketTimes) == 0 {
+		return time.RFC3339
+	}
+	first := bucketTimes[0]
+	last := bucketTimes[len(bucketTimes)-1]
+	timeLayout := "15:04"
+	if bucketDuration > 0 && bucketDuration < time.Minute {
+		timeLayout = "15:04:05"
+	}
+	if first.Format("2006-01-02") == last.Format("2006-01-02") {
+		return timeLayout
+	}
+	if first.Year() == last.Year() {
+		return "01-02 " + timeLayout
+	}
+	return time.RFC3339
+}
+
+// niceScale rounds the top of the y axis up to a multiple of 1, 2 or 5 times a power of 10,
+// returning it and the step between about 5 grid lines
+func niceScale(maxCount int) (int, int) {
+	if maxCount <= 0 {
+		return 1, 1
+	}
+	raw := float64(maxCount) / 5
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := 1
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*magnitude >= raw {
+			step = int(math.Max(1, m*magnitude))
+			break
+		}
+	}
+	return int(math.Ceil(float64(maxCount)/float64(step))) * step, step
+}
+
+func legendLabel(reference string) string {
+	label := []rune(strings.Join(strings.Fields(reference), " "))
+	if len(label) > maxLegendLength {
+		return string(label[:maxLegendLength]) + "..."
+	}
+	return string(label)
+}
+
+func svgEscape(s string) string {
+	b := &strings.Builder{}
+	xml.EscapeText(b, []byte(s))
+	return b.String()
+}
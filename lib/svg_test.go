@@ -0,0 +1,78 @@
+package lib
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChart(t *testing.T) {
+	tests := []struct {
+		name    string
+		options ChartOptions
+		texts   []string
+	}{
+		{
+			name:    "total",
+			options: ChartOptions{Title: "<b>logs</b>"},
+			texts:   []string{"<b>logs</b>", "start of <a.log>"},
+		},
+		{
+			name:    "top clusters",
+			options: ChartOptions{TopClusters: 1, BucketDuration: time.Minute},
+			texts:   []string{untrustedReference},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+			out := &bytes.Buffer{}
+			err := l.Chart(untrustedResult(), out, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a strict xml parse fails on unescaped text or unbalanced elements
+			decoder := xml.NewDecoder(bytes.NewReader(out.Bytes()))
+			elements := []string{}
+			texts := []string{}
+			for {
+				token, err := decoder.Token()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatalf("expected well formed svg: %v\n%s", err, out.String())
+				}
+				switch token := token.(type) {
+				case xml.StartElement:
+					elements = append(elements, token.Name.Local)
+				case xml.CharData:
+					texts = append(texts, string(token))
+				}
+			}
+			if len(elements) == 0 || elements[0] != "svg" {
+				t.Fatalf("expected an svg root element, got %v", elements)
+			}
+			for _, element := range elements {
+				if element == "script" || element == "b" || element == "img" {
+					t.Errorf("expected text to be escaped, got a %s element", element)
+				}
+			}
+			for _, text := range test.texts {
+				found := false
+				for _, t := range texts {
+					found = found || strings.Contains(t, text)
+				}
+				if !found {
+					t.Errorf("expected the text %q in the chart", text)
+				}
+			}
+		})
+	}
+}
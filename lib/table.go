@@ -0,0 +1,170 @@
+package lib
+
+import (
+	"encoding/csv"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// CountRow is the number of lines of a cluster from one source in one bucket
+type CountRow struct {
+	Start     time.Time
+	Reference string
+	Source    string
+	Count     int
+}
+
+// TableOptions select the clusters and layout of csv output. The long layout has a row per bucket,
+// cluster and source; the wide layout has a row per bucket and a column per cluster.
+type TableOptions struct {
+	MinCount int
+	Comma    rune
+	Wide     bool
+}
+
+// CountRows lists the lines of each cluster with at least minCount lines in a bucket by source,
+// ordered by bucket, reference and source
+func (l *logStat) CountRows(result *Result, minCount int) []CountRow {
+	rows := []CountRow{}
+	for bucketStart, bucket := range result.Buckets {
+		rows = append(rows, bucketRows(bucketStart, bucket, minCount)...)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if !rows[i].Start.Equal(rows[j].Start) {
+			return rows[i].Start.Before(rows[j].Start)
+		}
+		if rows[i].Reference != rows[j].Reference {
+			return rows[i].Reference < rows[j].Reference
+		}
+		return rows[i].Source < rows[j].Source
+	})
+	return rows
+}
+
+func bucketRows(bucketStart time.Time, bucket *Bucket, minCount int) []CountRow {
+	rows := []CountRow{}
+	for ref, c := range bucket.Clusters {
+		if c.Count < minCount {
+			continue
+		}
+		for source, count := range c.Sources {
+			rows = append(rows, CountRow{
+				Start:     bucketStart,
+				Reference: ref,
+				Source:    source,
+				Count:     count,
+			})
+		}
+	}
+	return rows
+}
+
+func (l *logStat) Table(result *Result, out io.Writer, options TableOptions) error {
+	w := newTableWriter(out, options)
+	if options.Wide {
+		return writeWideTable(w, result, options.MinCount)
+	}
+	err := writeLongHeader(w)
+	if err != nil {
+		return err
+	}
+	return writeLongRows(w, l.CountRows(result, options.MinCount))
+}
+
+// TableStreamPrinter returns a StreamBucket callback that writes the long table rows of each bucket
+func (l *logStat) TableStreamPrinter(out io.Writer, options TableOptions) func(bucketStart time.Time, bucket *Bucket) error {
+	w := newTableWriter(out, options)
+	header := false
+	return func(bucketStart time.Time, bucket *Bucket) error {
+		if !header {
+			header = true
+			err := writeLongHeader(w)
+			if err != nil {
+				return err
+			}
+		}
+		rows := bucketRows(bucketStart, bucket, options.MinCount)
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i].Reference != rows[j].Reference {
+				return rows[i].Reference < rows[j].Reference
+			}
+			return rows[i].Source < rows[j].Source
+		})
+		return writeLongRows(w, rows)
+	}
+}
+
+func newTableWriter(out io.Writer, options TableOptions) *csv.Writer {
+	w := csv.NewWriter(out)
+	if options.Comma != 0 {
+		w.Comma = options.Comma
+	}
+	return w
+}
+
+func writeLongHeader(w *csv.Writer) error {
+	return w.Write([]string{"bucket", "reference", "source", "count"})
+}
+
+func writeLongRows(w *csv.Writer, rows []CountRow) error {
+	for _, row := range rows {
+		err := w.Write([]string{row.Start.Format(time.RFC3339Nano), row.Reference, row.Source, strconv.Itoa(row.Count)})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// writeWideTable writes a row per bucket and a column per cluster with at least minCount lines in
+// some bucket, most common first. Clusters with fewer than minCount lines in a bucket count as 0.
+func writeWideTable(w *csv.Writer, result *Result, minCount int) error {
+	totals := map[string]int{}
+	for _, bucket := range result.Buckets {
+		for ref, c := range bucket.Clusters {
+			if c.Count >= minCount {
+				totals[ref] += c.Count
+			}
+		}
+	}
+	refs := []string{}
+	for ref := range totals {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if totals[refs[i]] != totals[refs[j]] {
+			return totals[refs[i]] > totals[refs[j]]
+		}
+		return refs[i] < refs[j]
+	})
+
+	err := w.Write(append([]string{"bucket"}, refs...))
+	if err != nil {
+		return err
+	}
+	bucketTimes := make(timeSlice, 0, len(result.Buckets))
+	for k := range result.Buckets {
+		bucketTimes = append(bucketTimes, k)
+	}
+	sort.Sort(bucketTimes)
+	for _, startTime := range bucketTimes {
+		bucket := result.Buckets[startTime]
+		row := []string{startTime.Format(time.RFC3339Nano)}
+		for _, ref := range refs {
+			count := 0
+			if c, ok := bucket.Clusters[ref]; ok && c.Count >= minCount {
+				count = c.Count
+			}
+			row = append(row, strconv.Itoa(count))
+		}
+		err = w.Write(row)
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
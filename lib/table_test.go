@@ -0,0 +1,118 @@
+package lib
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+// tableResult has two buckets, with a cluster from two sources and a reference that needs quoting
+func tableResult() *Result {
+	start := time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)
+	return &Result{Buckets: map[time.Time]*Bucket{
+		start: {
+			LineCount: 5,
+			Clusters: map[string]*Cluster{
+				"user (number) logged in": {Count: 4, Sources: map[string]int{"a.log": 3, "b.log": 1}},
+				`disk "full", retrying`:   {Count: 1, Sources: map[string]int{"b.log": 1}},
+			},
+		},
+		start.Add(time.Minute): {
+			LineCount: 2,
+			Clusters: map[string]*Cluster{
+				`disk "full", retrying`: {Count: 2, Sources: map[string]int{"b.log": 2}},
+			},
+		},
+	}}
+}
+
+func TestTable(t *testing.T) {
+	tests := []struct {
+		name     string
+		options  TableOptions
+		expected string
+	}{
+		{
+			name:    "long",
+			options: TableOptions{},
+			expected: `bucket,reference,source,count
+2023-10-17T04:00:00Z,"disk ""full"", retrying",b.log,1
+2023-10-17T04:00:00Z,user (number) logged in,a.log,3
+2023-10-17T04:00:00Z,user (number) logged in,b.log,1
+2023-10-17T04:01:00Z,"disk ""full"", retrying",b.log,2
+`,
+		},
+		{
+			name:    "long min count",
+			options: TableOptions{MinCount: 2},
+			expected: `bucket,reference,source,count
+2023-10-17T04:00:00Z,user (number) logged in,a.log,3
+2023-10-17T04:00:00Z,user (number) logged in,b.log,1
+2023-10-17T04:01:00Z,"disk ""full"", retrying",b.log,2
+`,
+		},
+		{
+			name:    "wide",
+			options: TableOptions{Wide: true},
+			expected: `bucket,user (number) logged in,"disk ""full"", retrying"
+2023-10-17T04:00:00Z,4,1
+2023-10-17T04:01:00Z,0,2
+`,
+		},
+		{
+			name:    "wide min count",
+			options: TableOptions{Wide: true, MinCount: 2},
+			expected: `bucket,user (number) logged in,"disk ""full"", retrying"
+2023-10-17T04:00:00Z,4,0
+2023-10-17T04:01:00Z,0,2
+`,
+		},
+		{
+			name:    "tsv",
+			options: TableOptions{Wide: true, Comma: '\t'},
+			expected: "bucket\tuser (number) logged in\t\"disk \"\"full\"\", retrying\"\n" +
+				"2023-10-17T04:00:00Z\t4\t1\n" +
+				"2023-10-17T04:01:00Z\t0\t2\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+			out := &bytes.Buffer{}
+			err := l.Table(tableResult(), out, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected\n%s\ngot\n%s", test.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestTableStreamPrinter(t *testing.T) {
+	l := &logStat{logger: log.New(ioutil.Discard, "", 0)}
+	out := &bytes.Buffer{}
+	printer := l.TableStreamPrinter(out, TableOptions{})
+	result := tableResult()
+	for _, start := range []time.Time{
+		time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC),
+		time.Date(2023, time.October, 17, 4, 1, 0, 0, time.UTC),
+	} {
+		err := printer(start, result.Buckets[start])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	expected := `bucket,reference,source,count
+2023-10-17T04:00:00Z,"disk ""full"", retrying",b.log,1
+2023-10-17T04:00:00Z,user (number) logged in,a.log,3
+2023-10-17T04:00:00Z,user (number) logged in,b.log,1
+2023-10-17T04:01:00Z,"disk ""full"", retrying",b.log,2
+`
+	if out.String() != expected {
+		t.Errorf("expected the header once and the rows of each bucket\n%s\ngot\n%s", expected, out.String())
+	}
+}
@@ -0,0 +1,100 @@
+package lib
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/drain"
+)
+
+const drainMaxChildren = 100
+
+// templateMarker stands in for a learned template in cluster keys until the template stops changing
+func templateMarker(g *drain.Group) string {
+	return fmt.Sprintf("\x00template %d\x00", g.ID)
+}
+
+// applyTemplates replaces template markers in the clusters of every bucket with the learned templates
+func applyTemplates(result *Result) {
+	if result.templates == nil {
+		return
+	}
+	for bucketStart, bucket := range result.Buckets {
+		result.Buckets[bucketStart] = templateBucket(bucket)
+	}
+}
+
+// templateView is a copy of the result with learned templates, leaving the result free to keep learning
+func templateView(result *Result) *Result {
+	if result.templates == nil {
+		return result
+	}
+	view := &Result{
+		ReferenceTime: result.ReferenceTime,
+		Buckets:       map[time.Time]*Bucket{},
+		ClockOffsets:  result.ClockOffsets,
+	}
+	for bucketStart, bucket := range result.Buckets {
+		view.Buckets[bucketStart] = templateBucket(bucket)
+	}
+	return view
+}
+
+// resultView is a copy of the result with learned templates and merged clusters, leaving the result
+// free to keep changing
+func resultView(result *Result, config Config) *Result {
+	view := templateView(result)
+	if config.FuzzyMerge > 0 {
+		if view == result {
+			view = &Result{
+				ReferenceTime: result.ReferenceTime,
+				Buckets:       map[time.Time]*Bucket{},
+				ClockOffsets:  result.ClockOffsets,
+			}
+			for bucketStart, bucket := range result.Buckets {
+				view.Buckets[bucketStart] = bucket
+			}
+		}
+		mergeSimilarClusters(view, config)
+	}
+	return view
+}
+
+// templateBucket keys the clusters of a bucket by their current templates, merging clusters whose
+// templates have converged
+func templateBucket(bucket *Bucket) *Bucket {
+	templated := &Bucket{
+		Notes:     bucket.Notes,
+		Clusters:  map[string]*Cluster{},
+		LineCount: bucket.LineCount,
+		Levels:    bucket.Levels,
+	}
+	for key, c := range bucket.Clusters {
+		if c.template != nil {
+			key = strings.Replace(key, templateMarker(c.template), c.template.String(), 1)
+		}
+		merged := templated.Clusters[key]
+		if merged == nil {
+			merged = &Cluster{
+				Reference:     key,
+				OriginalLines: map[time.Time][]string{},
+			}
+			templated.Clusters[key] = merged
+		}
+		for t, lines := range c.OriginalLines {
+			merged.OriginalLines[t] = append(merged.OriginalLines[t], lines...)
+		}
+		merged.Count += c.Count
+		merged.mergeWordValues(c)
+		merged.mergeCounts(c)
+		merged.template = c.template
+	}
+	for _, c := range templated.Clusters {
+		if c.template != nil {
+			templateValues(c, c.template)
+			c.template = nil
+		}
+	}
+	return templated
+}
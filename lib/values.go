@@ -0,0 +1,442 @@
+package lib
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/drain"
+)
+
+const (
+	// distinct values counted per placeholder, after which values are only counted as other
+	maxDistinctValues = 10000
+	// compiled references cached per source
+	maxCapturePatterns = 10000
+)
+
+// Values counts the values that denoising replaced at one placeholder of a cluster
+type Values struct {
+	Placeholder string
+	Counts      map[string]int
+	Other       int
+
+	// set when merged from clusters that did not all have this placeholder, so the values only
+	// cover some of the cluster's lines
+	partial bool
+}
+
+func (v *Values) add(value string) {
+	if _, ok := v.Counts[value]; !ok && len(v.Counts) >= maxDistinctValues {
+		v.Other++
+		return
+	}
+	v.Counts[value]++
+}
+
+// valueCapture recovers the values behind the placeholders of denoised lines by matching the
+// original line against its denoised reference with each placeholder as a group
+type valueCapture struct {
+	placeholders *regexp.Regexp
+	mutex        sync.Mutex
+	patterns     map[string]*regexp.Regexp
+}
+
+func newValueCapture(config Config) *valueCapture {
+	if !config.CaptureValues {
+		return nil
+	}
+	replacements := []string{DateReplacement, config.NoiseReplacement}
+	for _, d := range config.DenoisePatterns {
+		replacements = append(replacements, d[1])
+	}
+	for _, rule := range config.DenoiseRules {
+		replacements = append(replacements, rule.Replacement)
+	}
+	// longest first so that a placeholder containing another is found whole
+	sort.Slice(replacements, func(i, j int) bool {
+		return len(replacements[i]) > len(replacements[j])
+	})
+	quoted := []string{}
+	for _, r := range replacements {
+		if r != "" {
+			quoted = append(quoted, regexp.QuoteMeta(r))
+		}
+	}
+	return &valueCapture{
+		placeholders: regexp.MustCompile(strings.Join(quoted, "|")),
+		patterns:     map[string]*regexp.Regexp{},
+	}
+}
+
+// capture returns the placeholders of the denoised message and the values they replaced
+func (vc *valueCapture) capture(message string, denoised string) ([]string, []string) {
+	locations := vc.placeholders.FindAllStringIndex(denoised, -1)
+	if len(locations) == 0 {
+		return nil, nil
+	}
+	labels := make([]string, len(locations))
+	for i, loc := range locations {
+		labels[i] = denoised[loc[0]:loc[1]]
+	}
+
+	vc.mutex.Lock()
+	pattern := vc.patterns[denoised]
+	if pattern == nil {
+		if len(vc.patterns) >= maxCapturePatterns {
+			vc.patterns = map[string]*regexp.Regexp{}
+		}
+		expr := "(?s)^"
+		prev := 0
+		for _, loc := range locations {
+			expr += regexp.QuoteMeta(denoised[prev:loc[0]]) + "(.*?)"
+			prev = loc[1]
+		}
+		expr += regexp.QuoteMeta(denoised[prev:]) + "$"
+		pattern = regexp.MustCompile(expr)
+		vc.patterns[denoised] = pattern
+	}
+	vc.mutex.Unlock()
+
+	m := pattern.FindStringSubmatch(message)
+	if m == nil {
+		return labels, nil
+	}
+	return labels, m[1:]
+}
+
+// tokenValues returns the words of a message at each position of a drain template, preferring the
+// original words when denoising kept the number of words
+func tokenValues(template *drain.Group, e *entry) ([]string, []string) {
+	labels := append([]string{}, template.Template...)
+	values := strings.Fields(e.message)
+	if len(values) != len(labels) {
+		values = strings.Fields(e.denoised)
+	}
+	if len(values) != len(labels) {
+		return labels, nil
+	}
+	return labels, values
+}
+
+func (c *Cluster) addValues(labels []string, values []string) {
+	for len(c.Values) < len(values) {
+		label := labels[len(c.Values)]
+		if label == DateReplacement {
+			// datetimes are already summarized by the buckets
+			c.Values = append(c.Values, nil)
+			continue
+		}
+		c.Values = append(c.Values, &Values{
+			Placeholder: label,
+			Counts:      map[string]int{},
+		})
+	}
+	for i, value := range values {
+		if c.Values[i] != nil {
+			c.Values[i].add(value)
+		}
+	}
+}
+
+// keepLineValues remembers the values of each line so they can be recounted when lines are removed
+func (c *Cluster) keepLineValues(t time.Time, values []string) {
+	if c.lineValues == nil {
+		c.lineValues = map[time.Time][][]string{}
+	}
+	c.lineValues[t] = append(c.lineValues[t], values)
+}
+
+func (c *Cluster) recountValues() {
+	labels := []string{}
+	for _, v := range c.Values {
+		label := ""
+		if v != nil {
+			label = v.Placeholder
+		}
+		labels = append(labels, label)
+	}
+	previous := c.Values
+	c.Values = nil
+	for _, lines := range c.lineValues {
+		for _, values := range lines {
+			c.addValues(labels, values)
+		}
+	}
+	for i, v := range previous {
+		if v == nil && i < len(c.Values) {
+			// a datetime, or a drain template word that did not vary
+			c.Values[i] = nil
+		}
+	}
+}
+
+func (v *Values) merge(other *Values) {
+	for value, count := range other.Counts {
+		v.Counts[value] += count
+	}
+	v.Other += other.Other
+	v.partial = v.partial || other.partial
+}
+
+type placeholderKey struct {
+	placeholder string
+	occurrence  int
+}
+
+// mergeValues adds the values of another cluster. Placeholders that differ (e.g. between clusters
+// merged by --fuzzymerge) are matched by label and occurrence, and marked partial when missing from
+// either cluster instead of being dropped.
+func (c *Cluster) mergeValues(other *Cluster) {
+	if c.Count == 0 || samePlaceholders(c.Values, other.Values) {
+		c.mergeWordValues(other)
+		return
+	}
+	index := map[placeholderKey]int{}
+	seen := map[string]int{}
+	for i, v := range c.Values {
+		if v != nil {
+			index[placeholderKey{v.Placeholder, seen[v.Placeholder]}] = i
+			seen[v.Placeholder]++
+		}
+	}
+	matched := map[int]bool{}
+	seen = map[string]int{}
+	for _, v := range other.Values {
+		if v == nil {
+			continue
+		}
+		key := placeholderKey{v.Placeholder, seen[v.Placeholder]}
+		seen[v.Placeholder]++
+		i, ok := index[key]
+		if !ok {
+			c.Values = append(c.Values, &Values{
+				Placeholder: v.Placeholder,
+				Counts:      map[string]int{},
+				partial:     true,
+			})
+			i = len(c.Values) - 1
+		}
+		matched[i] = true
+		c.Values[i].merge(v)
+	}
+	for i, v := range c.Values {
+		if v != nil && !matched[i] {
+			v.partial = true
+		}
+	}
+	// line values no longer line up by position, and are only kept to recount values when applying
+	// relative bounds, which happens before clusters are merged
+	c.lineValues = nil
+}
+
+// mergeWordValues adds the values of another cluster position by position, e.g. of clusters with the
+// same placeholders, or of drain clusters whose templates have converged
+func (c *Cluster) mergeWordValues(other *Cluster) {
+	for i, v := range other.Values {
+		for len(c.Values) <= i {
+			c.Values = append(c.Values, nil)
+		}
+		if v == nil {
+			continue
+		}
+		if c.Values[i] == nil {
+			c.Values[i] = &Values{
+				Placeholder: v.Placeholder,
+				Counts:      map[string]int{},
+			}
+		}
+		c.Values[i].merge(v)
+	}
+	for t, lines := range other.lineValues {
+		if c.lineValues == nil {
+			c.lineValues = map[time.Time][][]string{}
+		}
+		c.lineValues[t] = append(c.lineValues[t], lines...)
+	}
+}
+
+// templateValues labels the values of a drain cluster with its final template, keeping only the
+// wildcards of the template and the positions whose values varied (e.g. a constant java.lang.(longword)
+// token is only summarized if it stood for different words)
+func templateValues(c *Cluster, template *drain.Group) {
+	for i, v := range c.Values {
+		if v == nil || i >= len(template.Template) {
+			continue
+		}
+		token := template.Template[i]
+		if token != drain.Wildcard && len(v.Counts) <= 1 && v.Other == 0 {
+			c.Values[i] = nil
+			continue
+		}
+		v.Placeholder = token
+	}
+}
+
+// ValueSummary describes the most common values of a placeholder, and their distribution when numeric.
+// Partial summaries only cover the Lines of a merged cluster that had the placeholder.
+type ValueSummary struct {
+	Placeholder string          `json:"placeholder"`
+	Distinct    int             `json:"distinct"`
+	Other       int             `json:"other"`
+	Lines       int             `json:"lines"`
+	Partial     bool            `json:"partial,omitempty"`
+	Top         []ValueCount    `json:"top"`
+	Numeric     *NumericSummary `json:"numeric,omitempty"`
+}
+
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// NumericSummary is the distribution of numeric values, or of durations in seconds (with Unit "s")
+type NumericSummary struct {
+	Unit string  `json:"unit,omitempty"`
+	Min  float64 `json:"min"`
+	P50  float64 `json:"p50"`
+	P90  float64 `json:"p90"`
+	P99  float64 `json:"p99"`
+	Max  float64 `json:"max"`
+}
+
+// summarizeValues returns the top values of a placeholder, and their distribution when numeric
+func summarizeValues(v *Values, top int) ValueSummary {
+	type valueCount struct {
+		value   string
+		number  float64
+		seconds float64
+		count   int
+	}
+	counts := []*valueCount{}
+	numeric := true
+	durations := true
+	total := 0
+	for value, count := range v.Counts {
+		vc := &valueCount{
+			value: value,
+			count: count,
+		}
+		counts = append(counts, vc)
+		total += count
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+			numeric = false
+		}
+		vc.number = n
+		seconds, ok := parseDuration(value)
+		if !ok {
+			durations = false
+		}
+		vc.seconds = seconds
+	}
+	unit := ""
+	if !numeric && durations {
+		// e.g. "took (duration)", summarized in seconds
+		for _, c := range counts {
+			c.number = c.seconds
+		}
+		numeric = true
+		unit = "s"
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].count != counts[j].count {
+			return counts[i].count > counts[j].count
+		}
+		return counts[i].value < counts[j].value
+	})
+
+	summary := ValueSummary{
+		Placeholder: v.Placeholder,
+		Distinct:    len(v.Counts),
+		Other:       v.Other,
+		Lines:       total + v.Other,
+		Partial:     v.partial,
+		Top:         []ValueCount{},
+	}
+	for i, c := range counts {
+		if i >= top {
+			break
+		}
+		summary.Top = append(summary.Top, ValueCount{
+			Value: c.value,
+			Count: c.count,
+		})
+	}
+	if numeric && len(counts) > 0 {
+		sort.Slice(counts, func(i, j int) bool {
+			return counts[i].number < counts[j].number
+		})
+		percentile := func(p float64) float64 {
+			rank := int(math.Ceil(p * float64(total)))
+			seen := 0
+			for _, c := range counts {
+				seen += c.count
+				if seen >= rank {
+					return c.number
+				}
+			}
+			return counts[len(counts)-1].number
+		}
+		summary.Numeric = &NumericSummary{
+			Unit: unit,
+			Min:  counts[0].number,
+			P50:  percentile(0.5),
+			P90:  percentile(0.9),
+			P99:  percentile(0.99),
+			Max:  counts[len(counts)-1].number,
+		}
+	}
+	return summary
+}
+
+func (s ValueSummary) String() string {
+	distinct := strconv.Itoa(s.Distinct)
+	if s.Other > 0 {
+		distinct += "+"
+	}
+	summary := fmt.Sprintf("%s: %s distinct", s.Placeholder, distinct)
+	if s.Partial {
+		summary = fmt.Sprintf("%s (in %d lines): %s distinct", s.Placeholder, s.Lines, distinct)
+	}
+	for _, c := range s.Top {
+		summary += fmt.Sprintf(", %s (%d)", strings.Replace(c.Value, "\n", " ", -1), c.Count)
+	}
+	if s.Numeric != nil {
+		format := func(n float64) string {
+			if s.Numeric.Unit == "s" {
+				return time.Duration(math.Round(n * float64(time.Second))).String()
+			}
+			return strconv.FormatFloat(n, 'f', -1, 64)
+		}
+		summary += fmt.Sprintf("; min %s p50 %s p90 %s p99 %s max %s", format(s.Numeric.Min),
+			format(s.Numeric.P50), format(s.Numeric.P90), format(s.Numeric.P99), format(s.Numeric.Max))
+	}
+	return summary
+}
+
+var isoDuration = regexp.MustCompile("^P(?:(\\d+(?:\\.\\d+)?)W)?(?:(\\d+(?:\\.\\d+)?)D)?(?:T(?:(\\d+(?:\\.\\d+)?)H)?(?:(\\d+(?:\\.\\d+)?)M)?(?:(\\d+(?:\\.\\d+)?)S)?)?$")
+
+// parseDuration reads a go (1m30s) or ISO 8601 (PT1H30M, without years or months) duration in seconds
+func parseDuration(value string) (float64, bool) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d.Seconds(), true
+	}
+	m := isoDuration.FindStringSubmatch(value)
+	if m == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, false
+	}
+	seconds := 0.0
+	for i, unit := range []float64{7 * 24 * 3600, 24 * 3600, 3600, 60, 1} {
+		if m[i+1] != "" {
+			n, _ := strconv.ParseFloat(m[i+1], 64)
+			seconds += n * unit
+		}
+	}
+	return seconds, true
+}
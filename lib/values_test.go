@@ -0,0 +1,305 @@
+package lib
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cjnosal/logstat/pkg/drain"
+)
+
+func TestValueCapture(t *testing.T) {
+	config := testConfig()
+	config.CaptureValues = true
+	vc := newValueCapture(config)
+	tests := []struct {
+		name     string
+		message  string
+		denoised string
+		labels   []string
+		values   []string
+	}{
+		{
+			name:     "placeholders",
+			message:  "GET /api/users/12 took 15ms",
+			denoised: "GET /api/users/(number) took (duration)",
+			labels:   []string{"(number)", "(duration)"},
+			values:   []string{"12", "15ms"},
+		},
+		{
+			name:     "datetime",
+			message:  "2023-10-17T04:00:00Z user 7 logged in",
+			denoised: DateReplacement + " user (number) logged in",
+			labels:   []string{DateReplacement, "(number)"},
+			values:   []string{"2023-10-17T04:00:00Z", "7"},
+		},
+		{
+			name:     "noise spanning lines",
+			message:  "failed: bad state\n\tat Foo.bar done",
+			denoised: "failed: * done",
+			labels:   []string{"*"},
+			values:   []string{"bad state\n\tat Foo.bar"},
+		},
+		{
+			name:     "no placeholders",
+			message:  "connection reset by peer",
+			denoised: "connection reset by peer",
+		},
+		{
+			name:     "message does not match",
+			message:  "user alice logged in",
+			denoised: "user (number) logged out",
+			labels:   []string{"(number)"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			labels, values := vc.capture(test.message, test.denoised)
+			if !reflect.DeepEqual(labels, test.labels) {
+				t.Errorf("expected labels %q, got %q", test.labels, labels)
+			}
+			if !reflect.DeepEqual(values, test.values) {
+				t.Errorf("expected values %q, got %q", test.values, values)
+			}
+		})
+	}
+}
+
+func TestSummarizeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		values   *Values
+		top      int
+		expected ValueSummary
+		text     string
+	}{
+		{
+			name: "numbers",
+			values: &Values{Placeholder: "(number)", Counts: map[string]int{
+				"5": 1, "10": 3, "20": 1, "100": 1,
+			}},
+			top: 2,
+			expected: ValueSummary{
+				Placeholder: "(number)",
+				Distinct:    4,
+				Lines:       6,
+				Top:         []ValueCount{{"10", 3}, {"100", 1}},
+				Numeric:     &NumericSummary{Min: 5, P50: 10, P90: 100, P99: 100, Max: 100},
+			},
+			text: "(number): 4 distinct, 10 (3), 100 (1); min 5 p50 10 p90 100 p99 100 max 100",
+		},
+		{
+			name: "durations",
+			values: &Values{Placeholder: "(duration)", Counts: map[string]int{
+				"15ms": 2, "1.5s": 1, "PT1M": 1,
+			}},
+			top: 2,
+			expected: ValueSummary{
+				Placeholder: "(duration)",
+				Distinct:    3,
+				Lines:       4,
+				Top:         []ValueCount{{"15ms", 2}, {"1.5s", 1}},
+				Numeric:     &NumericSummary{Unit: "s", Min: 0.015, P50: 0.015, P90: 60, P99: 60, Max: 60},
+			},
+			text: "(duration): 3 distinct, 15ms (2), 1.5s (1); min 15ms p50 15ms p90 1m0s p99 1m0s max 1m0s",
+		},
+		{
+			name: "words",
+			values: &Values{Placeholder: "(alphanum)", Counts: map[string]int{
+				"alice": 2, "7": 1,
+			}, Other: 3},
+			top: 5,
+			expected: ValueSummary{
+				Placeholder: "(alphanum)",
+				Distinct:    2,
+				Other:       3,
+				Lines:       6,
+				Top:         []ValueCount{{"alice", 2}, {"7", 1}},
+			},
+			text: "(alphanum): 2+ distinct, alice (2), 7 (1)",
+		},
+		{
+			name: "partial",
+			values: &Values{Placeholder: "(ip)", Counts: map[string]int{
+				"10.0.0.1": 2,
+			}, partial: true},
+			top: 5,
+			expected: ValueSummary{
+				Placeholder: "(ip)",
+				Distinct:    1,
+				Lines:       2,
+				Partial:     true,
+				Top:         []ValueCount{{"10.0.0.1", 2}},
+			},
+			text: "(ip) (in 2 lines): 1 distinct, 10.0.0.1 (2)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			summary := summarizeValues(test.values, test.top)
+			if !reflect.DeepEqual(summary, test.expected) {
+				t.Errorf("expected %+v, got %+v", test.expected, summary)
+			}
+			if summary.String() != test.text {
+				t.Errorf("expected %q, got %q", test.text, summary.String())
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		seconds float64
+		ok      bool
+	}{
+		{"150ms", 0.15, true},
+		{"1m30s", 90, true},
+		{"PT1H30M", 5400, true},
+		{"P1DT0.5S", 86400.5, true},
+		{"P2W", 1209600, true},
+		{"P1Y", 0, false},
+		{"PT", 0, false},
+		{"P", 0, false},
+		{"fast", 0, false},
+	}
+	for _, test := range tests {
+		seconds, ok := parseDuration(test.value)
+		if seconds != test.seconds || ok != test.ok {
+			t.Errorf("%s: expected %v %v, got %v %v", test.value, test.seconds, test.ok, seconds, ok)
+		}
+	}
+}
+
+func clusterWithValues(lines ...[]string) *Cluster {
+	c := &Cluster{}
+	for i := 0; i < len(lines); i += 2 {
+		c.addValues(lines[i], lines[i+1])
+		c.Count++
+	}
+	return c
+}
+
+func values(placeholder string, counts map[string]int, partial bool) *Values {
+	return &Values{Placeholder: placeholder, Counts: counts, partial: partial}
+}
+
+func TestMergeValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		clusters []*Cluster
+		expected []*Values
+	}{
+		{
+			name: "same placeholders",
+			clusters: []*Cluster{
+				clusterWithValues([]string{"(number)", "(duration)"}, []string{"1", "15ms"}),
+				clusterWithValues([]string{"(number)", "(duration)"}, []string{"2", "15ms"}),
+			},
+			expected: []*Values{
+				values("(number)", map[string]int{"1": 1, "2": 1}, false),
+				values("(duration)", map[string]int{"15ms": 2}, false),
+			},
+		},
+		{
+			name: "different placeholders",
+			clusters: []*Cluster{
+				clusterWithValues([]string{"(ip)", "(number)"}, []string{"10.0.0.1", "5"}),
+				clusterWithValues([]string{"(number)", "(number)"}, []string{"6", "7"}),
+			},
+			expected: []*Values{
+				values("(ip)", map[string]int{"10.0.0.1": 1}, true),
+				values("(number)", map[string]int{"5": 1, "6": 1}, false),
+				values("(number)", map[string]int{"7": 1}, true),
+			},
+		},
+		{
+			name: "datetimes",
+			clusters: []*Cluster{
+				clusterWithValues([]string{DateReplacement, "(number)"}, []string{"2023-10-17", "5"}),
+				clusterWithValues([]string{"(number)"}, []string{"6"}),
+			},
+			expected: []*Values{
+				nil,
+				values("(number)", map[string]int{"5": 1, "6": 1}, false),
+			},
+		},
+		{
+			name: "partial values stay partial",
+			clusters: []*Cluster{
+				clusterWithValues([]string{"(ip)"}, []string{"10.0.0.1"}),
+				clusterWithValues([]string{"(number)"}, []string{"6"}),
+				clusterWithValues([]string{"(ip)", "(number)"}, []string{"10.0.0.2", "7"}),
+			},
+			expected: []*Values{
+				values("(ip)", map[string]int{"10.0.0.1": 1, "10.0.0.2": 1}, true),
+				values("(number)", map[string]int{"6": 1, "7": 1}, true),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged := &Cluster{}
+			for _, c := range test.clusters {
+				merged.mergeValues(c)
+				merged.Count += c.Count
+			}
+			if !reflect.DeepEqual(merged.Values, test.expected) {
+				t.Errorf("expected %s, got %s", describeValues(test.expected), describeValues(merged.Values))
+			}
+		})
+	}
+}
+
+func describeValues(values []*Values) []string {
+	described := []string{}
+	for _, v := range values {
+		if v == nil {
+			described = append(described, "nil")
+			continue
+		}
+		described = append(described, summarizeValues(v, 10).String())
+	}
+	return described
+}
+
+func TestTemplateValues(t *testing.T) {
+	template := &drain.Group{Template: []string{"failed", "java.lang.(longword)::", "user", "(number)", "by", drain.Wildcard}}
+	tests := []struct {
+		name     string
+		cluster  *Cluster
+		expected []string
+	}{
+		{
+			name: "constant placeholder token",
+			cluster: clusterWithValues(
+				template.Template, []string{"failed", "java.lang.IllegalStateExceptionInHandler::", "user", "1", "by", "alice"},
+				template.Template, []string{"failed", "java.lang.IllegalStateExceptionInHandler::", "user", "2", "by", "alice"},
+			),
+			expected: []string{"nil", "nil", "nil", "(number): 2 distinct, 1 (1), 2 (1); min 1 p50 1 p90 2 p99 2 max 2", "nil", "<*>: 1 distinct, alice (2)"},
+		},
+		{
+			name: "varying placeholder token",
+			cluster: clusterWithValues(
+				template.Template, []string{"failed", "java.lang.IllegalStateExceptionInHandler::", "user", "1", "by", "alice"},
+				template.Template, []string{"failed", "java.lang.IllegalArgumentExceptionInHandler::", "user", "1", "by", "bob"},
+			),
+			expected: []string{
+				"nil",
+				"java.lang.(longword)::: 2 distinct, java.lang.IllegalArgumentExceptionInHandler:: (1), java.lang.IllegalStateExceptionInHandler:: (1)",
+				"nil",
+				"nil",
+				"nil",
+				"<*>: 2 distinct, alice (1), bob (1)",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			templateValues(test.cluster, template)
+			described := describeValues(test.cluster.Values)
+			if !reflect.DeepEqual(described, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, described)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package datetime
+
+import (
+	"regexp"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/regex"
+	"github.com/cjnosal/logstat/pkg/unixtime"
+)
+
+type Profile struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Extractors  []string
+	Formats     []string
+}
+
+var ISO = Profile{
+	Name:        "iso",
+	Description: "rfc3339-like numeric datetimes",
+	Extractors:  []string{regex.RFC3339LIKE},
+	Formats: []string{
+		time.RFC3339Nano,                     // - T n Zhh:mm
+		"2006-01-02T15:04:05.999999999Z0700", // - T n Zhhmm
+		"2006-01-02T15:04:05.999999999Z07",   // - T n Zhh
+		time.RFC3339,                         // - T   Zhh:mm
+		"2006-01-02T15:04:05Z0700",           // - T   Zhhmm
+		"2006-01-02T15:04:05Z07",             // - T   Zhh
+		"2006-01-02T15:04:05.999999999",      // - T n
+		"2006-01-02T15:04:05",                // - T
+
+		"2006/01/02T15:04:05.999999999Z07:00", // / T n Zhh:mm
+		"2006/01/02T15:04:05.999999999Z0700",  // / T n Zhhmm
+		"2006/01/02T15:04:05.999999999Z07",    // / T n Zhh
+		"2006/01/02T15:04:05Z07:00",           // / T   Zhh:mm
+		"2006/01/02T15:04:05Z0700",            // / T   Zhhmm
+		"2006/01/02T15:04:05Z07",              // / T   Zhh
+		"2006/01/02T15:04:05.999999999",       // / T n
+		"2006/01/02T15:04:05",                 // / T
+
+		"2006-01-02 15:04:05.999999999Z07:00", // -   n Zhh:mm
+		"2006-01-02 15:04:05.999999999Z0700",  // -   n Zhhmm
+		"2006-01-02 15:04:05.999999999Z07",    // -   n Zhh
+		"2006-01-02 15:04:05Z07:00",           // -     Zhh:mm
+		"2006-01-02 15:04:05Z0700",            // -     Zhhmm
+		"2006-01-02 15:04:05Z07",              // -     Zhh
+		"2006-01-02 15:04:05.999999999",       // -   n
+		"2006-01-02 15:04:05",                 // -
+
+		"2006/01/02 15:04:05.999999999Z07:00", // /   n Zhh:mm
+		"2006/01/02 15:04:05.999999999Z0700",  // /   n Zhhmm
+		"2006/01/02 15:04:05.999999999Z07",    // /   n Zhh
+		"2006/01/02 15:04:05Z07:00",           // /     Zhh:mm
+		"2006/01/02 15:04:05Z0700",            // /     Zhhmm
+		"2006/01/02 15:04:05Z07",              // /     Zhh
+		"2006/01/02 15:04:05.999999999",       // /   n
+		"2006/01/02 15:04:05",                 // /
+	},
+}
+
+// Catalog lists the built in profiles from most to least specific, so earlier profiles win ties
+var Catalog = []Profile{
+	{
+		Name:        "clf",
+		Aliases:     []string{"apache", "nginx"},
+		Description: "apache and nginx access logs [17/Oct/2023:04:12:01 -0400]",
+		Extractors:  []string{regex.CLFDATE},
+		Formats:     []string{"02/Jan/2006:15:04:05 -0700"},
+	},
+	{
+		Name:        "java",
+		Aliases:     []string{"log4j", "logback", "python"},
+		Description: "java (log4j, logback) and python logging 2023-10-17 04:12:01,123",
+		Extractors:  []string{regex.COMMAMILLISDATE},
+		Formats:     []string{"2006-01-02 15:04:05,000"},
+	},
+	{
+		Name:        "nginx-error",
+		Description: "nginx error logs 2023/10/17 04:12:01",
+		Extractors:  []string{regex.SLASHDATE},
+		Formats:     []string{"2006/01/02 15:04:05"},
+	},
+	{
+		Name:        "klog",
+		Aliases:     []string{"glog", "k8s"},
+		Description: "kubernetes klog and glog I1017 04:12:01.123456",
+		Extractors:  []string{regex.KLOGDATE},
+		Formats: []string{
+			"I0102 15:04:05.999999",
+			"W0102 15:04:05.999999",
+			"E0102 15:04:05.999999",
+			"F0102 15:04:05.999999",
+		},
+	},
+	{
+		Name:        "syslog",
+		Description: "bsd syslog Oct 17 04:12:01",
+		Extractors:  []string{regex.SYSLOGDATE},
+		Formats:     []string{"Jan _2 15:04:05"},
+	},
+	ISO,
+	{
+		Name:        "epoch",
+		Description: "unix timestamps in seconds, millis, micros or nanos",
+		Extractors:  []string{regex.EPOCH},
+		Formats:     []string{unixtime.Format},
+	},
+}
+
+// Parse parses datetime with a golang reference time layout or the unix timestamp pseudo format
+func Parse(format string, datetime string) (time.Time, error) {
+	return ParseInLocation(format, datetime, time.UTC)
+}
+
+// ParseInLocation is like Parse but interprets datetimes without a zone offset in location
+func ParseInLocation(format string, datetime string, location *time.Location) (time.Time, error) {
+	if format == unixtime.Format {
+		return unixtime.Parse(datetime)
+	}
+	return time.ParseInLocation(format, datetime, location)
+}
+
+// Find returns the catalog profile with the given name or alias
+func Find(name string) (*Profile, bool) {
+	for i := range Catalog {
+		if Catalog[i].Name == name {
+			return &Catalog[i], true
+		}
+		for _, alias := range Catalog[i].Aliases {
+			if alias == name {
+				return &Catalog[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Names lists the names of the catalog profiles
+func Names() []string {
+	names := make([]string, len(Catalog))
+	for i, p := range Catalog {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Discover returns the profile that parses a datetime from the most sample lines, and how many it parsed.
+// Ties go to the profile that extracts longer (more precise) datetimes, then to the earlier profile.
+func Discover(lines []string, profiles []Profile) (*Profile, int, error) {
+	var best *Profile
+	bestCount := 0
+	bestLength := 0
+	for i := range profiles {
+		p := &profiles[i]
+		extractors := make([]*regexp.Regexp, len(p.Extractors))
+		for j, e := range p.Extractors {
+			r, err := regexp.Compile(e)
+			if err != nil {
+				return nil, 0, err
+			}
+			extractors[j] = r
+		}
+		count := 0
+		length := 0
+		for _, line := range lines {
+			if n := parsedLength(line, extractors, p.Formats); n > 0 {
+				count++
+				length += n
+			}
+		}
+		if count > bestCount || (count == bestCount && count > 0 && length > bestLength) {
+			best = p
+			bestCount = count
+			bestLength = length
+		}
+	}
+	return best, bestCount, nil
+}
+
+func parsedLength(line string, extractors []*regexp.Regexp, formats []string) int {
+	for _, r := range extractors {
+		for _, datetime := range r.FindAllString(line, -1) {
+			for _, format := range formats {
+				if _, err := Parse(format, datetime); err == nil {
+					return len(datetime)
+				}
+			}
+		}
+	}
+	return 0
+}
+
+// YearInferrer fills in the year of layouts without one (e.g. syslog and klog)
+type YearInferrer struct {
+	reference time.Time
+	year      int
+	last      time.Time
+}
+
+// NewYearInferrer infers years relative to reference, which approximates the time of the last line
+// (e.g. the modification time of the log file)
+func NewYearInferrer(reference time.Time) *YearInferrer {
+	return &YearInferrer{
+		reference: reference,
+	}
+}
+
+// Infer assigns the reference year to the first time (or the previous year if that would be in the
+// future) and advances the year when later times roll over from December to January
+func (y *YearInferrer) Infer(t time.Time) time.Time {
+	if y.year == 0 {
+		y.year = y.reference.Year()
+		if withYear(t, y.year).After(y.reference.Add(24 * time.Hour)) {
+			y.year--
+		}
+	}
+	lt := withYear(t, y.year)
+	if !y.last.IsZero() && lt.Before(y.last.AddDate(0, -6, 0)) {
+		y.year++
+		lt = withYear(t, y.year)
+	}
+	y.last = lt
+	return lt
+}
+
+func withYear(t time.Time, year int) time.Time {
+	return time.Date(year, t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
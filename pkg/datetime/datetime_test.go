@@ -0,0 +1,185 @@
+package datetime
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cjnosal/logstat/pkg/unixtime"
+)
+
+func TestYearInferrer(t *testing.T) {
+	yearless := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(0, month, day, hour, 0, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name      string
+		reference time.Time
+		times     []time.Time
+		years     []int
+	}{
+		{
+			name:      "reference year",
+			reference: time.Date(2023, time.October, 17, 12, 0, 0, 0, time.UTC),
+			times:     []time.Time{yearless(time.October, 17, 4), yearless(time.October, 16, 23), yearless(time.October, 17, 11)},
+			years:     []int{2023, 2023, 2023},
+		},
+		{
+			name:      "december to january",
+			reference: time.Date(2024, time.January, 2, 10, 0, 0, 0, time.UTC),
+			times:     []time.Time{yearless(time.December, 30, 23), yearless(time.December, 31, 12), yearless(time.January, 1, 1), yearless(time.January, 2, 9)},
+			years:     []int{2023, 2023, 2024, 2024},
+		},
+		{
+			name:      "first time in the future",
+			reference: time.Date(2023, time.October, 17, 12, 0, 0, 0, time.UTC),
+			times:     []time.Time{yearless(time.December, 25, 0), yearless(time.January, 3, 0)},
+			years:     []int{2022, 2023},
+		},
+		{
+			name:      "first time less than a day ahead",
+			reference: time.Date(2023, time.October, 17, 0, 0, 0, 0, time.UTC),
+			times:     []time.Time{yearless(time.October, 17, 12)},
+			years:     []int{2023},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			y := NewYearInferrer(test.reference)
+			for i, yt := range test.times {
+				inferred := y.Infer(yt)
+				if inferred.Year() != test.years[i] {
+					t.Errorf("%s: expected year %d, got %d", yt.Format("Jan _2 15:04"), test.years[i], inferred.Year())
+				}
+				if inferred.Month() != yt.Month() || inferred.Day() != yt.Day() || inferred.Hour() != yt.Hour() {
+					t.Errorf("expected %s with a year, got %s", yt.Format("Jan _2 15:04"), inferred)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tests := []struct {
+		name    string
+		lines   []string
+		profile string
+		count   int
+	}{
+		{
+			name:    "clf",
+			lines:   []string{`10.0.0.1 - - [17/Oct/2023:04:12:01 -0400] "GET / HTTP/1.1" 200 512`},
+			profile: "clf",
+			count:   1,
+		},
+		{
+			name:    "longer java datetimes win the tie with iso",
+			lines:   []string{"2023-10-17 04:12:01,123 INFO started", "2023-10-17 04:12:02,456 INFO listening"},
+			profile: "java",
+			count:   2,
+		},
+		{
+			name:    "earlier nginx-error wins the tie with iso",
+			lines:   []string{"2023/10/17 04:12:01 [error] 12#12: connect() failed"},
+			profile: "nginx-error",
+			count:   1,
+		},
+		{
+			name:    "klog",
+			lines:   []string{"I1017 04:12:01.123456       1 server.go:42] started"},
+			profile: "klog",
+			count:   1,
+		},
+		{
+			name:    "syslog",
+			lines:   []string{"Oct 17 04:12:01 host sshd[123]: Accepted publickey"},
+			profile: "syslog",
+			count:   1,
+		},
+		{
+			name:    "iso",
+			lines:   []string{"2023-10-17T04:12:01.123Z started"},
+			profile: "iso",
+			count:   1,
+		},
+		{
+			name:    "epoch",
+			lines:   []string{`{"ts": 1697515921.123, "msg": "started"}`},
+			profile: "epoch",
+			count:   1,
+		},
+		{
+			name: "most lines win",
+			lines: []string{
+				"Oct 17 04:12:01 host app: started",
+				"2023-10-17T04:12:02Z started",
+				"2023-10-17T04:12:03Z listening",
+			},
+			profile: "iso",
+			count:   2,
+		},
+		{
+			name:  "no datetimes",
+			lines: []string{"starting", "listening on port 8080"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, count, err := Discover(test.lines, Catalog)
+			if err != nil {
+				t.Fatal(err)
+			}
+			name := ""
+			if p != nil {
+				name = p.Name
+			}
+			if name != test.profile || count != test.count {
+				t.Errorf("expected %q in %d lines, got %q in %d", test.profile, test.count, name, count)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+	}{
+		{"clf", "clf"},
+		{"nginx", "clf"},
+		{"log4j", "java"},
+		{"k8s", "klog"},
+		{"iso", "iso"},
+		{"unknown", ""},
+	}
+	for _, test := range tests {
+		p, ok := Find(test.name)
+		if (test.profile != "") != ok || (ok && p.Name != test.profile) {
+			t.Errorf("%s: expected %q, got %v", test.name, test.profile, p)
+		}
+	}
+}
+
+func TestParseInLocation(t *testing.T) {
+	edt := time.FixedZone("EDT", -4*3600)
+	tests := []struct {
+		name     string
+		format   string
+		datetime string
+		expected time.Time
+	}{
+		{"without an offset", "2006-01-02T15:04:05", "2023-10-17T04:00:00", time.Date(2023, time.October, 17, 8, 0, 0, 0, time.UTC)},
+		{"with an offset", time.RFC3339, "2023-10-17T04:00:00Z", time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+		{"with a numeric offset", time.RFC3339, "2023-10-17T04:00:00+02:00", time.Date(2023, time.October, 17, 2, 0, 0, 0, time.UTC)},
+		{"unix time", unixtime.Format, "1697515200", time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		parsed, err := ParseInLocation(test.format, test.datetime, edt)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !parsed.Equal(test.expected) {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, parsed.UTC())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	None  = ""
+	Gzip  = "gzip"
+	Bzip2 = "bzip2"
+	Zstd  = "zstd"
+	Xz    = "xz"
+
+	// bytes of a detected stream decompressed up front to check that it really is compressed
+	probeSize = 64 * 1024
+)
+
+var magics = []struct {
+	format string
+	magic  []byte
+	// bytes allowed after the magic, if any (e.g. the bzip2 block size)
+	next string
+}{
+	{Gzip, []byte{0x1f, 0x8b}, ""},
+	{Bzip2, []byte("BZh"), "123456789"},
+	{Zstd, []byte{0x28, 0xb5, 0x2f, 0xfd}, ""},
+	{Xz, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, ""},
+}
+
+// Detect returns the compression format of the stream based on its leading magic bytes
+func Detect(bufr *bufio.Reader) string {
+	for _, m := range magics {
+		size := len(m.magic)
+		if m.next != "" {
+			size++
+		}
+		peek, err := bufr.Peek(size)
+		if err == nil && bytes.Equal(peek[:len(m.magic)], m.magic) &&
+			(m.next == "" || bytes.IndexByte([]byte(m.next), peek[len(m.magic)]) >= 0) {
+			return m.format
+		}
+	}
+	return None
+}
+
+// NewReader transparently decompresses gzip, bzip2, zstd and xz streams and passes anything else through
+// unchanged, including text that merely starts with a magic (e.g. "BZh9...") but fails to decompress
+func NewReader(reader io.Reader) (io.ReadCloser, string, error) {
+	bufr := bufio.NewReaderSize(reader, probeSize)
+	format := Detect(bufr)
+	if format != None {
+		head, _ := bufr.Peek(probeSize)
+		if !decompresses(format, head) {
+			format = None
+		}
+	}
+	return open(format, bufr)
+}
+
+// decompresses reports whether the start of a stream decompresses, allowing it to end early
+func decompresses(format string, head []byte) bool {
+	r, _, err := open(format, bytes.NewReader(head))
+	if err != nil {
+		return false
+	}
+	defer r.Close()
+	_, err = r.Read(make([]byte, 1))
+	return err == nil || err == io.EOF || err == io.ErrUnexpectedEOF
+}
+
+func open(format string, reader io.Reader) (io.ReadCloser, string, error) {
+	switch format {
+	case Gzip:
+		r, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, format, err
+		}
+		return r, format, nil
+	case Bzip2:
+		return ioutil.NopCloser(bzip2.NewReader(reader)), format, nil
+	case Zstd:
+		r, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, format, err
+		}
+		return r.IOReadCloser(), format, nil
+	case Xz:
+		r, err := xz.NewReader(reader)
+		if err != nil {
+			return nil, format, err
+		}
+		return ioutil.NopCloser(r), format, nil
+	}
+	return ioutil.NopCloser(reader), None, nil
+}
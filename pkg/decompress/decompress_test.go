@@ -0,0 +1,141 @@
+package decompress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// bzip2Lines is "line 1\nline 2\n" compressed by bzip2 -9, which has no encoder in the standard library
+const bzip2Lines = "425a683931415926535931882168000005590000104000300002252000310c081286468931908710f177245385090318821680"
+
+func compress(t *testing.T, format string, text string) []byte {
+	b := &bytes.Buffer{}
+	var w io.WriteCloser
+	var err error
+	switch format {
+	case Gzip:
+		w = gzip.NewWriter(b)
+	case Zstd:
+		w, err = zstd.NewWriter(b)
+	case Xz:
+		w, err = xz.NewWriter(b)
+	default:
+		t.Fatalf("no writer for %s", format)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = io.WriteString(w, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// randomLines compress poorly, so their compressed stream is longer than the probe
+func randomLines(n int) string {
+	r := rand.New(rand.NewSource(1))
+	b := &strings.Builder{}
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(b, "line %d %016x%016x\n", i, r.Uint64(), r.Uint64())
+	}
+	return b.String()
+}
+
+func TestNewReader(t *testing.T) {
+	bz, err := hex.DecodeString(bzip2Lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := randomLines(5000)
+	tests := []struct {
+		name   string
+		input  []byte
+		format string
+		text   string
+	}{
+		{"plain text", []byte("line 1\nline 2\n"), None, "line 1\nline 2\n"},
+		{"empty", []byte{}, None, ""},
+		{"gzip", compress(t, Gzip, "line 1\nline 2\n"), Gzip, "line 1\nline 2\n"},
+		{"bzip2", bz, Bzip2, "line 1\nline 2\n"},
+		{"zstd", compress(t, Zstd, "line 1\nline 2\n"), Zstd, "line 1\nline 2\n"},
+		{"xz", compress(t, Xz, "line 1\nline 2\n"), Xz, "line 1\nline 2\n"},
+		{"gzip longer than the probe", compress(t, Gzip, long), Gzip, long},
+		{"zstd longer than the probe", compress(t, Zstd, long), Zstd, long},
+		{"xz longer than the probe", compress(t, Xz, long), Xz, long},
+		{"text starting with the bzip2 magic", []byte("BZh is not bzip2\n"), None, "BZh is not bzip2\n"},
+		{"text starting with the bzip2 header", []byte("BZh9 looks like bzip2\n"), None, "BZh9 looks like bzip2\n"},
+		{"text longer than the probe", []byte("BZh9 " + long), None, "BZh9 " + long},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r, format, err := NewReader(bytes.NewReader(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			if format != test.format {
+				t.Errorf("expected format %q, got %q", test.format, format)
+			}
+			text, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(text) != test.text {
+				t.Errorf("expected %d bytes of text, got %d", len(test.text), len(text))
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		input  string
+		format string
+	}{
+		{"\x1f\x8b\x08", Gzip},
+		{"BZh1", Bzip2},
+		{"BZh9", Bzip2},
+		{"BZh0", None},
+		{"BZhx", None},
+		{"BZh", None},
+		{"\x28\xb5\x2f\xfd", Zstd},
+		{"\xfd7zXZ\x00", Xz},
+		{"\xfd7zXZ", None},
+		{"2023-10-17T04:00:00Z", None},
+	}
+	for _, test := range tests {
+		format := Detect(bufio.NewReader(strings.NewReader(test.input)))
+		if format != test.format {
+			t.Errorf("%q: expected %q, got %q", test.input, test.format, format)
+		}
+	}
+}
+
+func TestDecompressesTruncatedStreams(t *testing.T) {
+	bz, err := hex.DecodeString(bzip2Lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decompresses(Bzip2, bz[:20]) {
+		t.Error("expected the start of a bzip2 stream to decompress")
+	}
+	if decompresses(Bzip2, []byte("BZh9 looks like bzip2")) {
+		t.Error("expected text not to decompress")
+	}
+}
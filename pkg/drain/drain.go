@@ -0,0 +1,156 @@
+package drain
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Wildcard replaces the template tokens that vary between messages
+const Wildcard = "<*>"
+
+// Group is a learned template. Its ID is stable while the template is generalized by later messages.
+type Group struct {
+	ID       int
+	Template []string
+}
+
+func (g *Group) String() string {
+	return strings.Join(g.Template, " ")
+}
+
+type node struct {
+	children map[string]*node
+	groups   []*Group
+}
+
+func newNode() *node {
+	return &node{
+		children: map[string]*node{},
+	}
+}
+
+// Miner learns templates with the fixed depth parse tree of the Drain algorithm
+// (He et al., "Drain: An Online Log Parsing Approach with Fixed Depth Tree", ICWS 2017).
+// Messages are split into whitespace separated tokens and routed by token count, then by
+// their leading tokens, to a leaf holding the groups they are compared with.
+type Miner struct {
+	depth       int
+	similarity  float64
+	maxChildren int
+	root        *node
+	groups      int
+}
+
+// NewMiner routes messages through depth-2 leading tokens (depth is at least 3), joins a group
+// when at least similarity of the tokens match its template, and limits each tree node to
+// maxChildren children before routing further tokens through a wildcard child
+func NewMiner(depth int, similarity float64, maxChildren int) *Miner {
+	if depth < 3 {
+		depth = 3
+	}
+	if maxChildren < 2 {
+		maxChildren = 2
+	}
+	return &Miner{
+		depth:       depth,
+		similarity:  similarity,
+		maxChildren: maxChildren,
+		root:        newNode(),
+	}
+}
+
+// Add returns the group of the message, generalizing its template or creating a new group
+func (m *Miner) Add(message string) *Group {
+	tokens := strings.Fields(message)
+	leaf := m.route(tokens)
+
+	var best *Group
+	bestSimilarity := -1.0
+	bestWildcards := -1
+	for _, g := range leaf.groups {
+		similarity, wildcards := compare(g.Template, tokens)
+		if similarity > bestSimilarity || (similarity == bestSimilarity && wildcards > bestWildcards) {
+			best = g
+			bestSimilarity = similarity
+			bestWildcards = wildcards
+		}
+	}
+	if best != nil && bestSimilarity >= m.similarity {
+		for i, t := range tokens {
+			if best.Template[i] != t {
+				best.Template[i] = Wildcard
+			}
+		}
+		return best
+	}
+
+	m.groups++
+	g := &Group{
+		ID:       m.groups,
+		Template: append([]string{}, tokens...),
+	}
+	leaf.groups = append(leaf.groups, g)
+	return g
+}
+
+// route finds or creates the leaf for the token count and leading tokens of a message
+func (m *Miner) route(tokens []string) *node {
+	current := m.child(m.root, strconv.Itoa(len(tokens)), true)
+	for i := 0; i < m.depth-2 && i < len(tokens); i++ {
+		key := tokens[i]
+		if hasDigit(key) {
+			key = Wildcard
+		}
+		current = m.child(current, key, false)
+	}
+	return current
+}
+
+func (m *Miner) child(parent *node, key string, exact bool) *node {
+	if c, ok := parent.children[key]; ok {
+		return c
+	}
+	if !exact {
+		_, hasWildcard := parent.children[Wildcard]
+		switch {
+		case hasWildcard && len(parent.children) >= m.maxChildren:
+			return parent.children[Wildcard]
+		case !hasWildcard && len(parent.children)+1 >= m.maxChildren:
+			// reserve the last child for tokens that do not fit
+			key = Wildcard
+		}
+	}
+	c := newNode()
+	parent.children[key] = c
+	return c
+}
+
+// compare returns the fraction of tokens equal to the template, not counting wildcards
+// as matches, and the number of wildcards in the template
+func compare(template []string, tokens []string) (float64, int) {
+	if len(tokens) == 0 {
+		return 1, 0
+	}
+	equal := 0
+	wildcards := 0
+	for i, t := range template {
+		if t == Wildcard {
+			wildcards++
+			continue
+		}
+		if t == tokens[i] {
+			equal++
+		}
+	}
+	return float64(equal) / float64(len(tokens)), wildcards
+}
+
+func hasDigit(token string) bool {
+	for _, r := range token {
+		if unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package drain
+
+import (
+	"testing"
+)
+
+func TestMinerAdd(t *testing.T) {
+	tests := []struct {
+		name        string
+		depth       int
+		similarity  float64
+		maxChildren int
+		messages    []string
+		groups      []int
+		template    string
+	}{
+		{
+			name:        "learns a template",
+			depth:       3,
+			similarity:  0.5,
+			maxChildren: 100,
+			messages: []string{
+				"User alice logged in from 10.0.0.1",
+				"User bob logged in from 10.0.0.2",
+				"User carol logged in from 10.0.0.3",
+			},
+			groups:   []int{1, 1, 1},
+			template: "User <*> logged in from <*>",
+		},
+		{
+			name:        "below the similarity threshold",
+			depth:       3,
+			similarity:  0.7,
+			maxChildren: 100,
+			messages: []string{
+				"User alice logged in from 10.0.0.1",
+				"User bob logged in from 10.0.0.2",
+			},
+			groups:   []int{1, 2},
+			template: "User bob logged in from 10.0.0.2",
+		},
+		{
+			name:        "different token counts",
+			depth:       3,
+			similarity:  0.1,
+			maxChildren: 100,
+			messages:    []string{"connection closed", "connection closed by peer"},
+			groups:      []int{1, 2},
+			template:    "connection closed by peer",
+		},
+		{
+			name:        "routes tokens with digits through the wildcard",
+			depth:       4,
+			similarity:  0.5,
+			maxChildren: 100,
+			messages:    []string{"7 retries left", "8 retries left"},
+			groups:      []int{1, 1},
+			template:    "<*> retries left",
+		},
+		{
+			name:        "routes through a wildcard once max children is reached",
+			depth:       3,
+			similarity:  0.5,
+			maxChildren: 3,
+			messages:    []string{"alpha done", "beta done", "gamma done", "delta done", "alpha done"},
+			// alpha and beta fill the node, leaving the last child as the wildcard for gamma and delta
+			groups:   []int{1, 2, 3, 3, 1},
+			template: "alpha done",
+		},
+		{
+			name:        "routes by the leading tokens within the depth",
+			depth:       4,
+			similarity:  0.5,
+			maxChildren: 100,
+			messages:    []string{"get user done", "get order done"},
+			groups:      []int{1, 2},
+			template:    "get order done",
+		},
+		{
+			name:        "compares the tokens past the depth",
+			depth:       3,
+			similarity:  0.5,
+			maxChildren: 100,
+			messages:    []string{"get user done", "get order done"},
+			groups:      []int{1, 1},
+			template:    "get <*> done",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := NewMiner(test.depth, test.similarity, test.maxChildren)
+			var g *Group
+			for i, message := range test.messages {
+				g = m.Add(message)
+				if g.ID != test.groups[i] {
+					t.Errorf("%q: expected group %d, got %d", message, test.groups[i], g.ID)
+				}
+			}
+			if g.String() != test.template {
+				t.Errorf("expected template %q, got %q", test.template, g.String())
+			}
+		})
+	}
+}
+
+func TestNewMinerLimits(t *testing.T) {
+	m := NewMiner(1, 0.5, 0)
+	if m.depth != 3 || m.maxChildren != 2 {
+		t.Errorf("expected depth 3 and 2 children, got depth %d and %d children", m.depth, m.maxChildren)
+	}
+}
@@ -0,0 +1,47 @@
+package jsonl
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Parse decodes a single JSON object and flattens nested objects into dotted keys (e.g. http.status)
+func Parse(line string) (map[string]string, error) {
+	decoder := json.NewDecoder(strings.NewReader(line))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	err := decoder.Decode(&object)
+	if err != nil {
+		return nil, fmt.Errorf("%v in json line %s", err, line)
+	}
+	if object == nil {
+		return nil, fmt.Errorf("not a json object: %s", line)
+	}
+	fields := map[string]string{}
+	flatten("", object, fields)
+	return fields, nil
+}
+
+func flatten(prefix string, object map[string]interface{}, fields map[string]string) {
+	for k, v := range object {
+		key := prefix + k
+		switch value := v.(type) {
+		case map[string]interface{}:
+			flatten(key+".", value, fields)
+		case string:
+			fields[key] = value
+		case json.Number:
+			fields[key] = value.String()
+		case nil:
+			fields[key] = ""
+		default:
+			buf := &bytes.Buffer{}
+			encoder := json.NewEncoder(buf)
+			encoder.SetEscapeHTML(false)
+			encoder.Encode(value)
+			fields[key] = strings.TrimSuffix(buf.String(), "\n")
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package jsonl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		line   string
+		fields map[string]string
+		err    bool
+	}{
+		{
+			name:   "strings",
+			line:   `{"time": "2023-10-17T04:00:00Z", "msg": "started"}`,
+			fields: map[string]string{"time": "2023-10-17T04:00:00Z", "msg": "started"},
+		},
+		{
+			name:   "numbers keep their text",
+			line:   `{"ts": 1697515200.123456, "status": 200, "big": 12345678901234567890}`,
+			fields: map[string]string{"ts": "1697515200.123456", "status": "200", "big": "12345678901234567890"},
+		},
+		{
+			name:   "nested objects",
+			line:   `{"http": {"method": "GET", "response": {"status": 404}}, "msg": "not found"}`,
+			fields: map[string]string{"http.method": "GET", "http.response.status": "404", "msg": "not found"},
+		},
+		{
+			name:   "arrays, booleans and nulls",
+			line:   `{"tags": ["a", "<b>"], "ok": true, "err": null}`,
+			fields: map[string]string{"tags": `["a","<b>"]`, "ok": "true", "err": ""},
+		},
+		{
+			name:   "empty object",
+			line:   `{}`,
+			fields: map[string]string{},
+		},
+		{
+			name: "not json",
+			line: `level=info msg=started`,
+			err:  true,
+		},
+		{
+			name: "not an object",
+			line: `null`,
+			err:  true,
+		},
+		{
+			name: "array",
+			line: `["a", "b"]`,
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fields, err := Parse(test.line)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", fields)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("expected %v, got %v", test.fields, fields)
+			}
+		})
+	}
+}
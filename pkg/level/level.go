@@ -0,0 +1,125 @@
+package level
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	Fatal   = "fatal"
+	Error   = "error"
+	Warn    = "warn"
+	Info    = "info"
+	Debug   = "debug"
+	Trace   = "trace"
+	Unknown = "unknown"
+)
+
+// Levels from most to least severe, followed by Unknown
+var Levels = []string{Fatal, Error, Warn, Info, Debug, Trace, Unknown}
+
+var (
+	names = map[string]string{
+		"fatal": Fatal, "panic": Fatal, "emerg": Fatal, "emergency": Fatal, "alert": Fatal, "crit": Fatal,
+		"critical": Fatal, "severe": Error, "error": Error, "err": Error, "eror": Error, "warn": Warn,
+		"warning": Warn, "wrn": Warn, "notice": Info, "info": Info, "inf": Info, "informational": Info,
+		"debug": Debug, "dbg": Debug, "fine": Debug, "config": Debug, "trace": Trace, "trc": Trace,
+		"finer": Trace, "finest": Trace,
+	}
+
+	priorityPattern = regexp.MustCompile("^<(\\d{1,3})>")
+	klogPattern     = regexp.MustCompile("^([IWEF])\\d{4} \\d\\d:\\d\\d:\\d\\d")
+	// level=error, uppercase tokens like ERROR, or bracketed tokens like [error] or <Warn>
+	tokenPattern = regexp.MustCompile("\\blevel=\"?(\\w+)|\\b(FATAL|PANIC|EMERG|ALERT|CRIT|CRITICAL|SEVERE|ERROR|ERR|WARN|WARNING|NOTICE|INFO|DEBUG|TRACE|FINE|FINER|FINEST)\\b|[\\[<(](?i:(fatal|panic|crit|critical|error|err|warn|warning|notice|info|debug|trace))[\\]>):]")
+)
+
+// Normalize maps a level name (in any case), a syslog severity (0-7) or a bunyan/pino level (10-60)
+// to one of Levels
+func Normalize(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if l, ok := names[value]; ok {
+		return l
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return Unknown
+	}
+	switch {
+	case n >= 0 && n <= 7:
+		return Severity(n)
+	case n == 10:
+		return Trace
+	case n == 20:
+		return Debug
+	case n == 30:
+		return Info
+	case n == 40:
+		return Warn
+	case n == 50:
+		return Error
+	case n == 60:
+		return Fatal
+	}
+	return Unknown
+}
+
+// Severity maps a syslog severity to a level
+func Severity(severity int) string {
+	switch {
+	case severity < 0 || severity > 7:
+		return Unknown
+	case severity <= 2:
+		return Fatal
+	case severity == 3:
+		return Error
+	case severity == 4:
+		return Warn
+	case severity <= 6:
+		return Info
+	}
+	return Debug
+}
+
+// Detect finds the level of a text line from a syslog priority, a klog prefix, or the first level token
+func Detect(line string) string {
+	if m := priorityPattern.FindStringSubmatch(line); m != nil {
+		priority, _ := strconv.Atoi(m[1])
+		return Severity(priority % 8)
+	}
+	if m := klogPattern.FindStringSubmatch(line); m != nil {
+		return map[string]string{"I": Info, "W": Warn, "E": Error, "F": Fatal}[m[1]]
+	}
+	if m := tokenPattern.FindStringSubmatch(line); m != nil {
+		for _, token := range m[1:] {
+			if token != "" {
+				return Normalize(token)
+			}
+		}
+	}
+	return Unknown
+}
+
+// Select returns the levels named by specs, where a level followed by + also selects the more
+// severe levels (e.g. warn+ selects fatal, error and warn)
+func Select(specs []string) (map[string]bool, error) {
+	selected := map[string]bool{}
+	for _, spec := range specs {
+		atLeast := strings.HasSuffix(spec, "+")
+		name := strings.TrimSuffix(spec, "+")
+		l := Normalize(name)
+		if l == Unknown && strings.ToLower(name) != Unknown {
+			return nil, fmt.Errorf("Unknown level %s (expected one of %v)", spec, Levels)
+		}
+		for _, candidate := range Levels {
+			if candidate == l || (atLeast && candidate != Unknown) {
+				selected[candidate] = true
+			}
+			if candidate == l {
+				break
+			}
+		}
+	}
+	return selected, nil
+}
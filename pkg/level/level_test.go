@@ -0,0 +1,102 @@
+package level
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		line  string
+		level string
+	}{
+		{"<11>Oct 17 04:12:01 host app: disk full", Error},
+		{"<14>Oct 17 04:12:01 host app: started", Info},
+		{"<0>Oct 17 04:12:01 host kernel: panic", Fatal},
+		{"<191>Oct 17 04:12:01 host app: polling", Debug},
+		{"I0102 15:04:05.000000       1 server.go:42] started", Info},
+		{"W0102 15:04:05.000000       1 server.go:42] slow", Warn},
+		{"E0102 15:04:05.000000       1 server.go:42] failed", Error},
+		{"F0102 15:04:05.000000       1 server.go:42] exiting", Fatal},
+		{"ts=2023-10-17T04:12:01Z level=warning msg=slow", Warn},
+		{`ts=2023-10-17T04:12:01Z level="err" msg=failed`, Error},
+		{"2023-10-17 04:12:01,123 ERROR [main] failed", Error},
+		{"2023-10-17 04:12:01 [warn] slow", Warn},
+		{"2023-10-17 04:12:01 <Info> started", Info},
+		{"2023-10-17 04:12:01 SEVERE: failed", Error},
+		{"an error occurred", Unknown},
+		{"started", Unknown},
+	}
+	for _, test := range tests {
+		if l := Detect(test.line); l != test.level {
+			t.Errorf("%q: expected %s, got %s", test.line, test.level, l)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		value string
+		level string
+	}{
+		{"warning", Warn},
+		{"WARN", Warn},
+		{"err", Error},
+		{" Error ", Error},
+		{"crit", Fatal},
+		{"notice", Info},
+		{"finest", Trace},
+		{"0", Fatal},
+		{"3", Error},
+		{"4", Warn},
+		{"6", Info},
+		{"7", Debug},
+		{"30", Info},
+		{"50", Error},
+		{"60", Fatal},
+		{"8", Unknown},
+		{"verbose", Unknown},
+	}
+	for _, test := range tests {
+		if l := Normalize(test.value); l != test.level {
+			t.Errorf("%q: expected %s, got %s", test.value, test.level, l)
+		}
+	}
+}
+
+func TestSelect(t *testing.T) {
+	tests := []struct {
+		specs    []string
+		selected []string
+		err      bool
+	}{
+		{specs: []string{"warn+"}, selected: []string{Fatal, Error, Warn}},
+		{specs: []string{"warning+"}, selected: []string{Fatal, Error, Warn}},
+		{specs: []string{"fatal+"}, selected: []string{Fatal}},
+		{specs: []string{"trace+"}, selected: []string{Fatal, Error, Warn, Info, Debug, Trace}},
+		{specs: []string{"err"}, selected: []string{Error}},
+		{specs: []string{"info", "unknown"}, selected: []string{Info, Unknown}},
+		{specs: []string{"error+", "debug"}, selected: []string{Fatal, Error, Debug}},
+		{specs: []string{"loud+"}, err: true},
+	}
+	for _, test := range tests {
+		selected, err := Select(test.specs)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %v", test.specs, selected)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.specs, err)
+			continue
+		}
+		expected := map[string]bool{}
+		for _, l := range test.selected {
+			expected[l] = true
+		}
+		if !reflect.DeepEqual(selected, expected) {
+			t.Errorf("%v: expected %v, got %v", test.specs, expected, selected)
+		}
+	}
+}
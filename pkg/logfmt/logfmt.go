@@ -0,0 +1,67 @@
+package logfmt
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type Pair struct {
+	Key   string
+	Value string
+}
+
+// Parse splits a logfmt line (key=value key="quoted value" flag) into its pairs in order
+func Parse(line string) ([]Pair, error) {
+	if !strings.Contains(line, "=") {
+		return nil, fmt.Errorf("no key=value pairs in logfmt line %s", line)
+	}
+	pairs := []Pair{}
+	i := 0
+	for {
+		for i < len(line) && line[i] == ' ' {
+			i++
+		}
+		if i >= len(line) {
+			break
+		}
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != '=' && line[i] != '"' {
+			i++
+		}
+		key := line[start:i]
+		if key == "" {
+			return nil, fmt.Errorf("missing key at offset %d in logfmt line %s", start, line)
+		}
+		if i >= len(line) || line[i] != '=' {
+			pairs = append(pairs, Pair{Key: key})
+			continue
+		}
+		i++
+		if i < len(line) && line[i] == '"' {
+			end := i + 1
+			for end < len(line) && line[end] != '"' {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("unterminated quote for key %s in logfmt line %s", key, line)
+			}
+			value, err := strconv.Unquote(line[i : end+1])
+			if err != nil {
+				value = line[i+1 : end]
+			}
+			pairs = append(pairs, Pair{Key: key, Value: value})
+			i = end + 1
+		} else {
+			start = i
+			for i < len(line) && line[i] != ' ' {
+				i++
+			}
+			pairs = append(pairs, Pair{Key: key, Value: line[start:i]})
+		}
+	}
+	return pairs, nil
+}
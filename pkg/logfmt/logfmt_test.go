@@ -0,0 +1,83 @@
+package logfmt
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		pairs []Pair
+		err   bool
+	}{
+		{
+			name:  "bare values",
+			line:  "level=info msg=started port=8080",
+			pairs: []Pair{{"level", "info"}, {"msg", "started"}, {"port", "8080"}},
+		},
+		{
+			name:  "quoted values",
+			line:  `level=error msg="connection reset by peer" user="alice"`,
+			pairs: []Pair{{"level", "error"}, {"msg", "connection reset by peer"}, {"user", "alice"}},
+		},
+		{
+			name:  "escaped quotes",
+			line:  `msg="said \"hi\" and left" path="C:\\logs"`,
+			pairs: []Pair{{"msg", `said "hi" and left`}, {"path", `C:\logs`}},
+		},
+		{
+			name:  "invalid escapes kept verbatim",
+			line:  `msg="bad \q escape"`,
+			pairs: []Pair{{"msg", `bad \q escape`}},
+		},
+		{
+			name:  "empty values",
+			line:  `msg= err="" done=true`,
+			pairs: []Pair{{"msg", ""}, {"err", ""}, {"done", "true"}},
+		},
+		{
+			name:  "flags",
+			line:  "debug level=info  verbose",
+			pairs: []Pair{{"debug", ""}, {"level", "info"}, {"verbose", ""}},
+		},
+		{
+			name:  "values containing equals",
+			line:  "query=a=b&c=d",
+			pairs: []Pair{{"query", "a=b&c=d"}},
+		},
+		{
+			name: "unterminated quote",
+			line: `msg="never closed`,
+			err:  true,
+		},
+		{
+			name: "missing key",
+			line: `level=info ="value"`,
+			err:  true,
+		},
+		{
+			name: "no pairs",
+			line: "plain text line",
+			err:  true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pairs, err := Parse(test.line)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", pairs)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(pairs, test.pairs) {
+				t.Errorf("expected %q, got %q", test.pairs, pairs)
+			}
+		})
+	}
+}
@@ -1,5 +1,10 @@
 package regex
 
+import (
+	"fmt"
+	"strings"
+)
+
 const (
 	GUID      = "\\{?[0-9a-fA-F]{8}\\-[0-9a-fA-F]{4}\\-[0-9a-fA-F]{4}\\-[0-9a-fA-F]{4}\\-[0-9a-fA-F]{12}\\}?"
 	BASE64    = "^(.*[^A-Za-z0-9])?([A-Za-z0-9+/]{4})*([A-Za-z0-9+/]{2}==|[A-Za-z0-9+/]{3}=)"
@@ -9,6 +14,48 @@ const (
 	LONGHEX   = "[0-9a-fA-F]{16,}"
 	LONGWORDS = "\\w{20,}"
 
+	URLS = "\\b[a-zA-Z][a-zA-Z0-9+.-]*://[^\\s\"'<>]+"
+	MACS = "(?i)\\b[0-9a-f]{2}([:-][0-9a-f]{2}){5}\\b"
+	IPV4 = "\\b((25[0-5]|2[0-4]\\d|1?\\d?\\d)\\.){3}(25[0-5]|2[0-4]\\d|1?\\d?\\d)(:\\d{1,5})?\\b"
+	IPV6 = "(?i)(\\b([0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\\b|\\b([0-9a-f]{1,4}:){1,6}(:[0-9a-f]{1,4}){1,6}\\b|\\b([0-9a-f]{1,4}:){1,7}:|::([0-9a-f]{1,4}:){0,6}[0-9a-f]{1,4}\\b)"
+	// unix paths under a well known root directory, or ending in a file name with an extension (so http
+	// routes like /api/users/123 are not paths)
+	UNIXPATHS = "\\B/(bin|boot|dev|etc|home|lib|lib64|mnt|nix|opt|private|proc|root|run|sbin|srv|sys|tmp|Users|usr|var|Volumes)\\b(/[\\w.@+-]+)*/?|\\B/([\\w.@+-]+/)*[\\w@+-]+\\.[A-Za-z][A-Za-z0-9]{0,5}\\b"
+	WINPATHS  = "(\\b[A-Za-z]:|\\\\\\\\[\\w.-]+)\\\\[^\\s\"'<>|:*?]*"
+	DURATIONS = "\\b(\\d+(\\.\\d+)?(ns|us|µs|ms|s|m|h))+\\b|\\bP((\\d+[YMWD])+(T(\\d+(\\.\\d+)?[HMS])+)?|T(\\d+(\\.\\d+)?[HMS])+)\\b"
+	// deployment pods end in a replicaset hash using the kubernetes alphabet without vowels and a 5
+	// character pod suffix (e.g. web-7d9f8c-x2kqz or web-7d9f8c-abcde)
+	K8SPODS = "\\b-[bcdfghjklmnpqrstvwxz2456789]{6,10}-[a-z0-9]{5}\\b"
+
 	// look for rfc3339-like numeric datetimes
 	RFC3339LIKE = "\\d\\d\\d\\d[-/]\\d\\d[-/]\\d\\d[T ]\\d\\d:\\d\\d:\\d\\d(\\.\\d*)?Z?[+-]?(\\d\\d)?:?(\\d\\d)?"
+
+	// look for other common datetime layouts
+	CLFDATE         = "\\d\\d/[A-Z][a-z][a-z]/\\d\\d\\d\\d:\\d\\d:\\d\\d:\\d\\d [+-]\\d\\d\\d\\d"
+	COMMAMILLISDATE = "\\d\\d\\d\\d-\\d\\d-\\d\\d \\d\\d:\\d\\d:\\d\\d,\\d\\d\\d"
+	SLASHDATE       = "\\d\\d\\d\\d/\\d\\d/\\d\\d \\d\\d:\\d\\d:\\d\\d"
+	KLOGDATE        = "\\b[IWEF]\\d\\d\\d\\d \\d\\d:\\d\\d:\\d\\d\\.\\d{6}"
+	SYSLOGDATE      = "\\b[A-Z][a-z][a-z] [ \\d]\\d \\d\\d:\\d\\d:\\d\\d"
+
+	// look for unix timestamps in seconds, millis, micros or nanos
+	EPOCH = "\\b(\\d{9,10}|\\d{13}|\\d{16}|\\d{19})(\\.\\d{1,9})?\\b"
 )
+
+// K8SREPLICASETS matches the hash ending a replicaset name (e.g. web-7d9f8c): 6 to 10 characters of the
+// kubernetes alphabet including a digit, so that words like -backend are left alone
+var K8SREPLICASETS = k8sHash()
+
+func k8sHash() string {
+	const letters = "[bcdfghjklmnpqrstvwxz]"
+	const alphabet = "[bcdfghjklmnpqrstvwxz2456789]"
+	// the first digit can be at any of the 10 positions, with enough characters after it to make 6
+	alternatives := []string{}
+	for i := 0; i < 10; i++ {
+		least := 5 - i
+		if least < 0 {
+			least = 0
+		}
+		alternatives = append(alternatives, fmt.Sprintf("%s{%d}[2456789]%s{%d,%d}", letters, i, alphabet, least, 9-i))
+	}
+	return "\\b-(" + strings.Join(alternatives, "|") + ")\\b"
+}
@@ -0,0 +1,44 @@
+package regex
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestReplace(t *testing.T) {
+	tests := []struct {
+		pattern     string
+		replacement string
+		input       string
+		expected    string
+	}{
+		{UNIXPATHS, "(path)", "open /var/log/syslog failed", "open (path) failed"},
+		{UNIXPATHS, "(path)", "cd /tmp", "cd (path)"},
+		{UNIXPATHS, "(path)", "installed to /usr/local/bin/", "installed to (path)"},
+		{UNIXPATHS, "(path)", "reading /app/config/settings.yaml", "reading (path)"},
+		{UNIXPATHS, "(path)", "sourced /home/me/.bashrc", "sourced (path)"},
+		{UNIXPATHS, "(path)", "GET /api/users/123 took 15ms", "GET /api/users/123 took 15ms"},
+		{UNIXPATHS, "(path)", "GET /api/v1.2/users", "GET /api/v1.2/users"},
+		{UNIXPATHS, "(path)", "GET /variables/x", "GET /variables/x"},
+		{UNIXPATHS, "(path)", "ratio 1/2 of a/b", "ratio 1/2 of a/b"},
+		{K8SPODS, "-(pod)", "pod web-7d9f8c-x2kqz started", "pod web-(pod) started"},
+		{K8SPODS, "-(pod)", "pod web-7d9f8c-abcde started", "pod web-(pod) started"},
+		{K8SPODS, "-(pod)", "nginx-deployment-66b6c48dd5-4jw2p", "nginx-deployment-(pod)"},
+		{K8SPODS, "-(pod)", "job my-bcdfgh-word", "job my-bcdfgh-word"},
+		{K8SREPLICASETS, "-(replicaset)", "replicaset web-7d9f8c", "replicaset web-(replicaset)"},
+		{K8SREPLICASETS, "-(replicaset)", "scaled nginx-deployment-66b6c48dd5 to 3", "scaled nginx-deployment-(replicaset) to 3"},
+		{K8SREPLICASETS, "-(replicaset)", "replicaset web-bcdfg7h", "replicaset web-(replicaset)"},
+		{K8SREPLICASETS, "-(replicaset)", "web-bcdfgh", "web-bcdfgh"},
+		{K8SREPLICASETS, "-(replicaset)", "my-backend", "my-backend"},
+		{K8SREPLICASETS, "-(replicaset)", "worker-2 and error-404", "worker-2 and error-404"},
+		{K8SREPLICASETS, "-(replicaset)", "web-7d9f8c4b2d9f", "web-7d9f8c4b2d9f"},
+		{DURATIONS, "(duration)", "took 15ms then 1m30s", "took (duration) then (duration)"},
+		{DURATIONS, "(duration)", "timeout PT1H30M", "timeout (duration)"},
+	}
+	for _, test := range tests {
+		actual := regexp.MustCompile(test.pattern).ReplaceAllString(test.input, test.replacement)
+		if actual != test.expected {
+			t.Errorf("replacing %s in %q: expected %q, got %q", test.pattern, test.input, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RFC 3164 timestamps have no year and pad the day with a space
+	rfc3164Layout = "Jan _2 15:04:05"
+	nilValue      = "-"
+)
+
+type Message struct {
+	Priority       int
+	Facility       int
+	Severity       int
+	Timestamp      time.Time
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string
+	Message        string
+}
+
+// Parser reads RFC 3164 and RFC 5424 messages
+type Parser struct {
+	location *time.Location
+}
+
+// NewYearlessParser leaves the year of RFC 3164 timestamps at 0, so that a caller parsing lines
+// concurrently can infer years in line order
+func NewYearlessParser(location *time.Location) *Parser {
+	if location == nil {
+		location = time.UTC
+	}
+	return &Parser{
+		location: location,
+	}
+}
+
+func (p *Parser) Parse(line string) (*Message, error) {
+	m := &Message{
+		Priority: -1,
+		Facility: -1,
+		Severity: -1,
+	}
+	rest := line
+	if strings.HasPrefix(rest, "<") {
+		end := strings.Index(rest, ">")
+		if end < 2 || end > 4 {
+			return nil, fmt.Errorf("invalid priority in syslog line %s", line)
+		}
+		pri, err := strconv.Atoi(rest[1:end])
+		if err != nil || pri > 191 {
+			return nil, fmt.Errorf("invalid priority in syslog line %s", line)
+		}
+		m.Priority = pri
+		m.Facility = pri / 8
+		m.Severity = pri % 8
+		rest = rest[end+1:]
+	}
+	if strings.HasPrefix(rest, "1 ") {
+		return m, p.parse5424(m, rest[2:], line)
+	}
+	return m, p.parse3164(m, rest, line)
+}
+
+func (p *Parser) parse5424(m *Message, rest string, line string) error {
+	fields := strings.SplitN(rest, " ", 6)
+	if len(fields) < 5 {
+		return fmt.Errorf("truncated header in syslog line %s", line)
+	}
+	if fields[0] != nilValue {
+		t, err := time.Parse(time.RFC3339Nano, fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid timestamp in syslog line %s: %v", line, err)
+		}
+		m.Timestamp = t
+	}
+	m.Hostname = nilToEmpty(fields[1])
+	m.AppName = nilToEmpty(fields[2])
+	m.ProcID = nilToEmpty(fields[3])
+	m.MsgID = nilToEmpty(fields[4])
+	if len(fields) < 6 {
+		return nil
+	}
+	rest = fields[5]
+	if strings.HasPrefix(rest, nilValue) {
+		rest = rest[1:]
+	} else if strings.HasPrefix(rest, "[") {
+		end := structuredDataEnd(rest)
+		if end < 0 {
+			return fmt.Errorf("unterminated structured data in syslog line %s", line)
+		}
+		m.StructuredData = rest[:end]
+		rest = rest[end:]
+	}
+	m.Message = strings.TrimPrefix(strings.TrimPrefix(rest, " "), "\ufeff")
+	return nil
+}
+
+// structuredDataEnd finds the end of a sequence of [id param="value"] elements
+func structuredDataEnd(sd string) int {
+	i := 0
+	for i < len(sd) && sd[i] == '[' {
+		quoted := false
+		for i++; i < len(sd); i++ {
+			if sd[i] == '\\' && quoted {
+				i++
+			} else if sd[i] == '"' {
+				quoted = !quoted
+			} else if sd[i] == ']' && !quoted {
+				break
+			}
+		}
+		if i >= len(sd) {
+			return -1
+		}
+		i++
+	}
+	return i
+}
+
+func (p *Parser) parse3164(m *Message, rest string, line string) error {
+	fields := strings.SplitN(rest, " ", 2)
+	if t, err := time.Parse(time.RFC3339Nano, fields[0]); err == nil {
+		// high precision timestamps written by rsyslog and syslog-ng
+		m.Timestamp = t
+		if len(fields) < 2 {
+			return nil
+		}
+		rest = fields[1]
+	} else {
+		if len(rest) < len(rfc3164Layout) {
+			return fmt.Errorf("truncated header in syslog line %s", line)
+		}
+		t, err := time.ParseInLocation(rfc3164Layout, rest[:len(rfc3164Layout)], p.location)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp in syslog line %s: %v", line, err)
+		}
+		m.Timestamp = t
+		rest = strings.TrimPrefix(rest[len(rfc3164Layout):], " ")
+	}
+
+	fields = strings.SplitN(rest, " ", 2)
+	m.Hostname = fields[0]
+	if len(fields) < 2 {
+		return nil
+	}
+	rest = fields[1]
+
+	tagEnd := strings.IndexAny(rest, ":[ ")
+	if tagEnd > 0 && rest[tagEnd] != ' ' {
+		m.AppName = rest[:tagEnd]
+		rest = rest[tagEnd:]
+		if strings.HasPrefix(rest, "[") {
+			end := strings.Index(rest, "]")
+			if end > 0 {
+				m.ProcID = rest[1:end]
+				rest = rest[end+1:]
+			}
+		}
+		rest = strings.TrimPrefix(rest, ":")
+	}
+	m.Message = strings.TrimPrefix(rest, " ")
+	return nil
+}
+
+func nilToEmpty(value string) string {
+	if value == nilValue {
+		return ""
+	}
+	return value
+}
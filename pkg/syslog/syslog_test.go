@@ -0,0 +1,151 @@
+package syslog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		line    string
+		message *Message
+		err     bool
+	}{
+		{
+			name: "rfc 3164",
+			line: "<34>Oct 11 22:14:15 mymachine su: 'su root' failed for lonvick on /dev/pts/8",
+			message: &Message{
+				Priority:  34,
+				Facility:  4,
+				Severity:  2,
+				Timestamp: time.Date(0, time.October, 11, 22, 14, 15, 0, time.UTC),
+				Hostname:  "mymachine",
+				AppName:   "su",
+				Message:   "'su root' failed for lonvick on /dev/pts/8",
+			},
+		},
+		{
+			name: "rfc 3164 without priority, with a padded day and pid",
+			line: "Oct  7 04:12:01 host sshd[123]: Accepted publickey for alice",
+			message: &Message{
+				Priority:  -1,
+				Facility:  -1,
+				Severity:  -1,
+				Timestamp: time.Date(0, time.October, 7, 4, 12, 1, 0, time.UTC),
+				Hostname:  "host",
+				AppName:   "sshd",
+				ProcID:    "123",
+				Message:   "Accepted publickey for alice",
+			},
+		},
+		{
+			name: "rfc 3164 with a high precision timestamp",
+			line: "2023-10-17T04:12:01.123456+00:00 host kernel: oom-killer invoked",
+			message: &Message{
+				Priority:  -1,
+				Facility:  -1,
+				Severity:  -1,
+				Timestamp: time.Date(2023, time.October, 17, 4, 12, 1, 123456000, time.UTC),
+				Hostname:  "host",
+				AppName:   "kernel",
+				Message:   "oom-killer invoked",
+			},
+		},
+		{
+			name: "rfc 5424 with structured data",
+			line: `<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"]` + " \ufeffAn application event log entry",
+			message: &Message{
+				Priority:       165,
+				Facility:       20,
+				Severity:       5,
+				Timestamp:      time.Date(2003, time.October, 11, 22, 14, 15, 3000000, time.UTC),
+				Hostname:       "mymachine.example.com",
+				AppName:        "evntslog",
+				MsgID:          "ID47",
+				StructuredData: `[exampleSDID@32473 iut="3" eventSource="Application" eventID="1011"]`,
+				Message:        "An application event log entry",
+			},
+		},
+		{
+			name: "rfc 5424 with several structured data elements and escapes",
+			line: `<13>1 2023-10-17T04:00:00Z host app 12 - [a@1 x="q\"]"][b@1 y="2"] done`,
+			message: &Message{
+				Priority:       13,
+				Facility:       1,
+				Severity:       5,
+				Timestamp:      time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC),
+				Hostname:       "host",
+				AppName:        "app",
+				ProcID:         "12",
+				StructuredData: `[a@1 x="q\"]"][b@1 y="2"]`,
+				Message:        "done",
+			},
+		},
+		{
+			name: "rfc 5424 without structured data",
+			line: "<13>1 2023-10-17T04:00:00Z host app - - - hello world",
+			message: &Message{
+				Priority:  13,
+				Facility:  1,
+				Severity:  5,
+				Timestamp: time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC),
+				Hostname:  "host",
+				AppName:   "app",
+				Message:   "hello world",
+			},
+		},
+		{
+			name: "rfc 5424 nil values",
+			line: "<14>1 - - - - - -",
+			message: &Message{
+				Priority: 14,
+				Facility: 1,
+				Severity: 6,
+			},
+		},
+		{
+			name: "unterminated structured data",
+			line: `<13>1 2023-10-17T04:00:00Z host app - - [a@1 x="1" done`,
+			err:  true,
+		},
+		{
+			name: "truncated rfc 5424 header",
+			line: "<13>1 2023-10-17T04:00:00Z host",
+			err:  true,
+		},
+		{
+			name: "priority out of range",
+			line: "<192>Oct 11 22:14:15 host app: message",
+			err:  true,
+		},
+		{
+			name: "no timestamp",
+			line: "not a syslog line",
+			err:  true,
+		},
+	}
+	p := NewYearlessParser(time.UTC)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m, err := p.Parse(test.line)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", m)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !m.Timestamp.Equal(test.message.Timestamp) {
+				t.Errorf("expected timestamp %s, got %s", test.message.Timestamp, m.Timestamp)
+			}
+			m.Timestamp = test.message.Timestamp
+			if !reflect.DeepEqual(m, test.message) {
+				t.Errorf("expected %+v, got %+v", test.message, m)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package unixtime
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Format is the pseudo layout for unix timestamps
+const Format = "epoch"
+
+var (
+	// timestamps outside this range are more likely to be ids or counters than times
+	MinTime = time.Date(1990, time.January, 1, 0, 0, 0, 0, time.UTC)
+	MaxTime = time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC)
+)
+
+// Parse converts a unix timestamp to a time, inferring seconds, milliseconds, microseconds
+// or nanoseconds from the number of integer digits
+func Parse(value string) (time.Time, error) {
+	integer := value
+	fraction := ""
+	if i := strings.Index(value, "."); i >= 0 {
+		integer = value[:i]
+		fraction = value[i+1:]
+	}
+	if len(integer) == 0 || strings.Trim(integer, "0123456789") != "" || strings.Trim(fraction, "0123456789") != "" {
+		return time.Time{}, fmt.Errorf("%s is not a unix timestamp", value)
+	}
+
+	var scale int64
+	switch digits := len(strings.TrimLeft(integer, "0")); {
+	case digits <= 10:
+		scale = int64(time.Second)
+	case digits <= 13:
+		scale = int64(time.Millisecond)
+	case digits <= 16:
+		scale = int64(time.Microsecond)
+	case digits <= 19:
+		scale = int64(time.Nanosecond)
+	default:
+		return time.Time{}, fmt.Errorf("%s is too large for a unix timestamp", value)
+	}
+
+	number, ok := new(big.Rat).SetString(integer + "." + fraction + "0")
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s is not a unix timestamp", value)
+	}
+	nanos := new(big.Rat).Mul(number, new(big.Rat).SetInt64(scale))
+	n := new(big.Int).Quo(nanos.Num(), nanos.Denom())
+	if !n.IsInt64() {
+		return time.Time{}, fmt.Errorf("%s is too large for a unix timestamp", value)
+	}
+	t := time.Unix(0, n.Int64()).UTC()
+	if t.Before(MinTime) || !t.Before(MaxTime) {
+		return time.Time{}, fmt.Errorf("%s is outside the range of plausible unix timestamps (%s to %s)", value, MinTime, MaxTime)
+	}
+	return t, nil
+}
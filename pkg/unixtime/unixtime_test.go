@@ -0,0 +1,51 @@
+package unixtime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Time
+		err      bool
+	}{
+		{name: "seconds", value: "1697515200", expected: time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+		{name: "fractional seconds", value: "1697515200.5", expected: time.Date(2023, time.October, 17, 4, 0, 0, 500000000, time.UTC)},
+		{name: "millis", value: "1697515200123", expected: time.Date(2023, time.October, 17, 4, 0, 0, 123000000, time.UTC)},
+		{name: "fractional millis", value: "1697515200123.456", expected: time.Date(2023, time.October, 17, 4, 0, 0, 123456000, time.UTC)},
+		{name: "micros", value: "1697515200123456", expected: time.Date(2023, time.October, 17, 4, 0, 0, 123456000, time.UTC)},
+		{name: "nanos", value: "1697515200123456789", expected: time.Date(2023, time.October, 17, 4, 0, 0, 123456789, time.UTC)},
+		{name: "nine digit seconds", value: "946684800", expected: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "leading zeros", value: "001697515200", expected: time.Date(2023, time.October, 17, 4, 0, 0, 0, time.UTC)},
+		{name: "start of range", value: "631152000", expected: MinTime},
+		{name: "before 1990", value: "631151999", err: true},
+		{name: "end of range", value: "4102444800", err: true},
+		{name: "just before the end of range", value: "4102444799", expected: MaxTime.Add(-time.Second)},
+		{name: "small counter", value: "42", err: true},
+		{name: "twenty digits", value: "16975152001234567890", err: true},
+		{name: "negative", value: "-1697515200", err: true},
+		{name: "not a number", value: "2023-10-17", err: true},
+		{name: "empty", value: "", err: true},
+		{name: "only a fraction", value: ".5", err: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := Parse(test.value)
+			if test.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", parsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !parsed.Equal(test.expected) {
+				t.Errorf("expected %s, got %s", test.expected, parsed)
+			}
+		})
+	}
+}